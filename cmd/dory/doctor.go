@@ -0,0 +1,120 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	flexvol "github.com/hpe-storage/dory/common/k8s/flexvol"
+	"github.com/hpe-storage/dory/common/linux"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+const (
+	cmdDoctor = "doctor"
+)
+
+//doctorReport is printed by the doctor command
+type doctorReport struct {
+	Driver  string               `json:"driver"`
+	Version string               `json:"version"`
+	Healthy bool                 `json:"healthy"`
+	Checks  []*flexvol.Diagnosis `json:"checks"`
+}
+
+// doctor checks the node and prints a json report.  It returns false if any check failed.
+func doctor(name string) bool {
+	report := &doctorReport{
+		Driver:  filepath.Base(name),
+		Version: fmt.Sprintf("%s-%s", Version, Commit),
+		Healthy: true,
+	}
+
+	initialize(name, false)
+	report.Checks = append(report.Checks, diagnoseConfig(name))
+	report.Checks = append(report.Checks, diagnoseLogPath())
+	report.Checks = append(report.Checks, diagnoseSelinux())
+
+	dockervolOptions := getDockervolOptions()
+	// capabilities are checked by Diagnose so a failure there doesn't hide the other checks
+	dockervolOptions.SupportsCapabilities = false
+	err := flexvol.Config(name, dockervolOptions, getFlexvolOptions())
+	report.Checks = append(report.Checks, flexvol.Diagnose(err)...)
+
+	for _, check := range report.Checks {
+		if check.Status == flexvol.DiagnosisFailed {
+			report.Healthy = false
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Println(flexvol.FailureJSON)
+		return false
+	}
+	fmt.Println(string(data))
+	return report.Healthy
+}
+
+func diagnoseConfig(name string) *flexvol.Diagnosis {
+	diagnosis := &flexvol.Diagnosis{Check: "config", Status: flexvol.DiagnosisOK, Message: name + ".json"}
+	data, err := ioutil.ReadFile(name + ".json")
+	if err != nil {
+		diagnosis.Status = flexvol.DiagnosisWarning
+		diagnosis.Message = fmt.Sprintf("using defaults - %s", err.Error())
+		return diagnosis
+	}
+	config := make(map[string]interface{})
+	err = json.Unmarshal(data, &config)
+	if err != nil {
+		diagnosis.Status = flexvol.DiagnosisFailed
+		diagnosis.Message = fmt.Sprintf("unable to parse %s.json - %s", name, err.Error())
+		return diagnosis
+	}
+	// options that aren't in the file just use their defaults
+	for opt := range config {
+		if err, found := configErrors[opt]; found {
+			diagnosis.Status = flexvol.DiagnosisFailed
+			diagnosis.Details = append(diagnosis.Details, fmt.Sprintf("%s - %s", opt, err.Error()))
+		}
+	}
+	sort.Strings(diagnosis.Details)
+	return diagnosis
+}
+
+func diagnoseLogPath() *flexvol.Diagnosis {
+	diagnosis := &flexvol.Diagnosis{Check: "log", Status: flexvol.DiagnosisOK, Message: logFilePath}
+	file, err := os.OpenFile(logFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		diagnosis.Status = flexvol.DiagnosisFailed
+		diagnosis.Message = err.Error()
+		return diagnosis
+	}
+	file.Close()
+	return diagnosis
+}
+
+func diagnoseSelinux() *flexvol.Diagnosis {
+	if linux.SelinuxEnabled() {
+		return &flexvol.Diagnosis{Check: "selinux", Status: flexvol.DiagnosisOK,
+			Message: fmt.Sprintf("enabled, labeling with %s type=%s level=%s", selinuxLabel, selinuxType, selinuxLevel)}
+	}
+	return &flexvol.Diagnosis{Check: "selinux", Status: flexvol.DiagnosisOK, Message: "disabled"}
+}
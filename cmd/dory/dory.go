@@ -24,17 +24,36 @@ import (
 	"github.com/hpe-storage/dory/common/util"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
 const (
 	cmdConfigChk = "config"
 	//override options
 	optDockerVolumePluginSocketPath = "dockerVolumePluginSocketPath"
+	optDockerVolumePluginCAFile     = "dockerVolumePluginCAFile"
+	optDockerVolumePluginCertFile   = "dockerVolumePluginCertFile"
+	optDockerVolumePluginKeyFile    = "dockerVolumePluginKeyFile"
 	optStripK8sFromOptions          = "stripK8sFromOptions"
 	optLogFilePath                  = "logFilePath"
+	optReplayLogPath                = "replayLogPath"
 	optDebug                        = "logDebug"
 	optCreateVolumes                = "createVolumes"
 	optEnable16                     = "enable1.6"
+	optEnableAttach                 = "enableAttach"
+	optFsGroupChangePolicy          = "fsGroupChangePolicy"
+	optLockDirectory                = "lockDirectory"
+	optLockTimeoutSeconds           = "lockTimeoutSeconds"
+	optKubeletRootDirs              = "kubeletRootDirs"
+	optSelinuxLabel                 = "selinuxLabel"
+	optSelinuxType                  = "selinuxType"
+	optSelinuxLevel                 = "selinuxLevel"
+	optRetryMaxTries                = "retryMaxTries"
+	optRetryDelaySeconds            = "retryDelaySeconds"
+	optRetryMaxDelaySeconds         = "retryMaxDelaySeconds"
+	optRetryJitterPercent           = "retryJitterPercent"
+	optRetryDeadlineSeconds         = "retryDeadlineSeconds"
 	optFactorForConversion          = "factorForConversion"
 	optListOfStorageResourceOptions = "listOfStorageResourceOptions"
 	optSupportsCapabilities         = "supportsCapabilities"
@@ -47,14 +66,44 @@ var (
 	Commit = "unknown"
 
 	dockerVolumePluginSocketPath = "/run/docker/plugins/nimble.sock"
+	dockerVolumePluginCAFile     = ""
+	dockerVolumePluginCertFile   = ""
+	dockerVolumePluginKeyFile    = ""
 	stripK8sFromOptions          = true
 	logFilePath                  = "/var/log/dory.log"
+	replayLogPath                = ""
 	debug                        = false
 	createVolumes                = true
 	enable16                     = false
+	enableAttach                 = false
+	fsGroupChangePolicy          = flexvol.FsGroupChangeAlways
+	lockDirectory                = flexvol.DefaultLockDir
+	lockTimeoutSeconds           = int(flexvol.DefaultLockTimeout / time.Second)
+	kubeletRootDirs              = flexvol.DefaultKubeletRootDirs
+	selinuxLabel                 = flexvol.SelinuxLabelChcon
+	selinuxType                  = flexvol.DefaultSelinuxType
+	selinuxLevel                 = ""
+	retryMaxTries                = util.DefaultRetryMaxTries
+	retryDelaySeconds            = int(util.DefaultRetryDelay / time.Second)
+	retryMaxDelaySeconds         = int(util.DefaultRetryMaxDelay / time.Second)
+	retryJitterPercent           = util.DefaultRetryJitterPercent
+	retryDeadlineSeconds         = int(util.DefaultRetryBudget / time.Second)
 	factorForConversion          = 1073741824
 	listOfStorageResourceOptions = []string{"size", "sizeInGiB"}
 	supportsCapabilities         = true
+
+	//configErrors holds the errors found for each option by initialize
+	configErrors = make(map[string]error)
+
+	//configOptions are the options in the order initialize reports their errors
+	configOptions = []string{
+		optLogFilePath, optReplayLogPath, optDockerVolumePluginSocketPath, optDockerVolumePluginCAFile,
+		optDockerVolumePluginCertFile, optDockerVolumePluginKeyFile, optDebug, optSupportsCapabilities,
+		optStripK8sFromOptions, optCreateVolumes, optListOfStorageResourceOptions, optFactorForConversion,
+		optEnable16, optEnableAttach, optFsGroupChangePolicy, optLockDirectory, optLockTimeoutSeconds,
+		optKubeletRootDirs, optSelinuxLabel, optSelinuxType, optSelinuxLevel, optRetryMaxTries,
+		optRetryDelaySeconds, optRetryMaxDelaySeconds, optRetryJitterPercent, optRetryDeadlineSeconds,
+	}
 )
 
 func main() {
@@ -64,6 +113,38 @@ func main() {
 	}
 
 	driverCommand := os.Args[1]
+	switch driverCommand {
+	case cmdDoctor:
+		if !doctor(os.Args[0]) {
+			os.Exit(1)
+		}
+		return
+	case cmdGC:
+		if err := gc(os.Args[0], os.Args[2:]); err != nil {
+			fmt.Printf("Unable to %s - %s\n", driverCommand, err.Error())
+			os.Exit(1)
+		}
+		return
+	case cmdReplay:
+		if err := replay(os.Args[2:]); err != nil {
+			fmt.Printf("Unable to %s - %s\n", driverCommand, err.Error())
+			os.Exit(1)
+		}
+		return
+	case cmdInstall, cmdUninstall:
+		var err error
+		if driverCommand == cmdInstall {
+			err = install(os.Args[2:])
+		} else {
+			err = uninstall(os.Args[2:])
+		}
+		if err != nil {
+			fmt.Printf("Unable to %s - %s\n", driverCommand, err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
 	justCheckConfig := false
 	if driverCommand == cmdConfigChk {
 		justCheckConfig = true
@@ -79,8 +160,38 @@ func main() {
 	pid := os.Getpid()
 	util.LogInfo.Printf("[%d] entry  : Driver=%s Version=%s-%s Socket=%s Overridden=%t", pid, filepath.Base(os.Args[0]), Version, Commit, dockerVolumePluginSocketPath, overridden)
 
-	util.LogInfo.Printf("[%d] request: %s %v", pid, driverCommand, os.Args[2:])
-	dockervolOptions := &dockervol.Options{
+	util.LogInfo.Printf("[%d] request: %s %s", pid, driverCommand, util.RedactSecrets(fmt.Sprint(os.Args[2:])))
+	var record *replayRecord
+	if replayLogPath != "" {
+		record = newReplayRecord(os.Args[0], driverCommand, os.Args[2:])
+	}
+	mess := run(os.Args[0], driverCommand, os.Args[2:])
+	util.LogInfo.Printf("[%d] reply  : %s %s: %v", pid, driverCommand, util.RedactSecrets(fmt.Sprint(os.Args[2:])), mess)
+	if record != nil {
+		if err := record.finish(replayLogPath, mess); err != nil {
+			util.LogError.Printf("[%d] unable to append to replay log %s - %s", pid, replayLogPath, err.Error())
+		}
+	}
+
+	fmt.Println(mess)
+}
+
+// run connects to the docker volume plugin and handles the driver command
+func run(name, driverCommand string, args []string) string {
+	err := flexvol.Config(name, getDockervolOptions(), getFlexvolOptions())
+	if err != nil && flexvol.RequiresPlugin(driverCommand) {
+		response := flexvol.ErrorResponse(flexvol.ClassifyError(flexvol.ErrorCodePluginUnreachable, err))
+		response.Message = fmt.Sprintf("Unable to communicate with docker volume plugin - %s", err.Error())
+		return flexvol.BuildJSONResponse(response)
+	}
+	if err != nil {
+		util.LogInfo.Printf("[%d] unable to communicate with docker volume plugin, %s doesn't require it - %s", os.Getpid(), driverCommand, err.Error())
+	}
+	return flexvol.Handle(driverCommand, enable16, args)
+}
+
+func getDockervolOptions() *dockervol.Options {
+	options := &dockervol.Options{
 		SocketPath:                   dockerVolumePluginSocketPath,
 		StripK8sFromOptions:          stripK8sFromOptions,
 		CreateVolumes:                createVolumes,
@@ -88,18 +199,30 @@ func main() {
 		FactorForConversion:          factorForConversion,
 		SupportsCapabilities:         supportsCapabilities,
 	}
-	err := flexvol.Config(os.Args[0], dockervolOptions)
-	var mess string
-	if err != nil {
-		mess = flexvol.BuildJSONResponse(&flexvol.Response{
-			Status:  flexvol.FailureStatus,
-			Message: fmt.Sprintf("Unable to communicate with docker volume plugin - %s", err.Error())})
-	} else {
-		mess = flexvol.Handle(driverCommand, enable16, os.Args[2:])
+	if dockerVolumePluginCAFile != "" || dockerVolumePluginCertFile != "" || dockerVolumePluginKeyFile != "" {
+		options.TLSConfig = &dockervol.TLSConfig{
+			CAFile:   dockerVolumePluginCAFile,
+			CertFile: dockerVolumePluginCertFile,
+			KeyFile:  dockerVolumePluginKeyFile,
+		}
 	}
-	util.LogInfo.Printf("[%d] reply  : %s %v: %v", pid, driverCommand, os.Args[2:], mess)
+	return options
+}
 
-	fmt.Println(mess)
+func getFlexvolOptions() *flexvol.Options {
+	return &flexvol.Options{
+		EnableAttach:        enableAttach,
+		FsGroupChangePolicy: fsGroupChangePolicy,
+		LockDir:             lockDirectory,
+		LockTimeout:         time.Duration(lockTimeoutSeconds) * time.Second,
+		KubeletRootDirs:     kubeletRootDirs,
+		SelinuxLabel:        selinuxLabel,
+		SelinuxType:         selinuxType,
+		SelinuxLevel:        selinuxLevel,
+		// the deadline starts now, so this is only called once per invocation
+		RetryPolicy: util.NewRetryPolicy(retryMaxTries, time.Duration(retryDelaySeconds)*time.Second,
+			time.Duration(retryMaxDelaySeconds)*time.Second, retryJitterPercent, time.Duration(retryDeadlineSeconds)*time.Second),
+	}
 }
 
 func initialize(name string, report bool) bool {
@@ -115,36 +238,61 @@ func initialize(name string, report bool) bool {
 		return false
 	}
 
+	configErrors = validateConfig(c)
+	if report {
+		for _, opt := range configOptions {
+			if err, found := configErrors[opt]; found {
+				fmt.Printf("Error processing option '%s' - %s\n", opt, err.Error())
+			}
+		}
+	}
+
 	s, err := c.GetStringWithError(optLogFilePath)
 	if err == nil && s != "" {
 		override = true
 		logFilePath = s
-	} else {
-		configOptCheck(report, optLogFilePath, err)
+	}
+
+	s, err = c.GetStringWithError(optReplayLogPath)
+	if err == nil {
+		override = true
+		replayLogPath = s
 	}
 
 	s, err = c.GetStringWithError(optDockerVolumePluginSocketPath)
 	if err == nil && s != "" {
 		override = true
 		dockerVolumePluginSocketPath = s
-	} else {
-		configOptCheck(report, optDockerVolumePluginSocketPath, err)
+	}
+
+	s, err = c.GetStringWithError(optDockerVolumePluginCAFile)
+	if err == nil {
+		override = true
+		dockerVolumePluginCAFile = s
+	}
+
+	s, err = c.GetStringWithError(optDockerVolumePluginCertFile)
+	if err == nil {
+		override = true
+		dockerVolumePluginCertFile = s
+	}
+
+	s, err = c.GetStringWithError(optDockerVolumePluginKeyFile)
+	if err == nil {
+		override = true
+		dockerVolumePluginKeyFile = s
 	}
 
 	b, err := c.GetBool(optDebug)
 	if err == nil {
 		override = true
 		debug = b
-	} else {
-		configOptCheck(report, optDebug, err)
 	}
 
 	b, err = c.GetBool(optSupportsCapabilities)
 	if err == nil {
 		override = true
 		supportsCapabilities = b
-	} else {
-		configOptCheck(report, optSupportsCapabilities, err)
 	}
 
 	overrideFlexVol := initializeFlexVolOptions(c, report)
@@ -162,50 +310,192 @@ func initializeFlexVolOptions(c *jconfig.Config, report bool) bool {
 	if err == nil {
 		override = true
 		stripK8sFromOptions = b
-	} else {
-		configOptCheck(report, optStripK8sFromOptions, err)
 	}
 
 	b, err = c.GetBool(optCreateVolumes)
 	if err == nil {
 		override = true
 		createVolumes = b
-	} else {
-		configOptCheck(report, optCreateVolumes, err)
 	}
 
-	ss, err := c.GetStringSliceWithError(optListOfStorageResourceOptions)
+	ss, _ := c.GetStringSliceWithError(optListOfStorageResourceOptions)
 	if ss != nil {
 		override = true
 		listOfStorageResourceOptions = ss
-	} else {
-		configOptCheck(report, optListOfStorageResourceOptions, err)
 	}
 
 	i, err := c.GetInt64SliceWithError(optFactorForConversion)
 	if err == nil {
 		override = true
 		factorForConversion = int(i)
-	} else {
-		configOptCheck(report, optFactorForConversion, err)
 	}
 
 	e16, err := c.GetBool(optEnable16)
 	if err == nil {
 		override = true
 		enable16 = e16
-	} else {
-		configOptCheck(report, optEnable16, err)
+	}
+
+	b, err = c.GetBool(optEnableAttach)
+	if err == nil {
+		override = true
+		enableAttach = b
+	}
+
+	s, err := c.GetStringWithError(optFsGroupChangePolicy)
+	if err == nil {
+		s, err = parseFsGroupChangePolicy(s)
+	}
+	if err == nil {
+		override = true
+		fsGroupChangePolicy = s
+	}
+
+	s, err = c.GetStringWithError(optLockDirectory)
+	if err == nil && s != "" {
+		override = true
+		lockDirectory = s
+	}
+
+	i, err = c.GetInt64SliceWithError(optLockTimeoutSeconds)
+	if err == nil && i > 0 {
+		override = true
+		lockTimeoutSeconds = int(i)
+	}
+
+	ss, _ = c.GetStringSliceWithError(optKubeletRootDirs)
+	if ss != nil {
+		override = true
+		kubeletRootDirs = ss
+	}
+
+	s, err = c.GetStringWithError(optSelinuxLabel)
+	if err == nil {
+		s, err = parseSelinuxLabel(s)
+	}
+	if err == nil {
+		override = true
+		selinuxLabel = s
+	}
+
+	s, err = c.GetStringWithError(optSelinuxType)
+	if err == nil && s != "" {
+		override = true
+		selinuxType = s
+	}
+
+	s, err = c.GetStringWithError(optSelinuxLevel)
+	if err == nil {
+		override = true
+		selinuxLevel = s
+	}
+
+	if initializeRetryOptions(c) {
+		override = true
 	}
 	configOptDump(report)
 
 	return override
 }
 
-func configOptCheck(report bool, optName string, err error) {
-	if report {
-		fmt.Printf("Error processing option '%s' - %s\n", optName, err.Error())
+func initializeRetryOptions(c *jconfig.Config) bool {
+	override := false
+
+	i, err := c.GetInt64SliceWithError(optRetryMaxTries)
+	if err == nil && i > 0 {
+		override = true
+		retryMaxTries = int(i)
+	}
+
+	i, err = c.GetInt64SliceWithError(optRetryDelaySeconds)
+	if err == nil && i >= 0 {
+		override = true
+		retryDelaySeconds = int(i)
+	}
+
+	i, err = c.GetInt64SliceWithError(optRetryMaxDelaySeconds)
+	if err == nil && i >= 0 {
+		override = true
+		retryMaxDelaySeconds = int(i)
+	}
+
+	i, err = c.GetInt64SliceWithError(optRetryJitterPercent)
+	if err == nil && i >= 0 && i <= 100 {
+		override = true
+		retryJitterPercent = int(i)
+	}
+
+	// 0 means no deadline
+	i, err = c.GetInt64SliceWithError(optRetryDeadlineSeconds)
+	if err == nil && i >= 0 {
+		override = true
+		retryDeadlineSeconds = int(i)
+	}
+
+	return override
+}
+
+func parseFsGroupChangePolicy(policy string) (string, error) {
+	for _, p := range []string{flexvol.FsGroupChangeAlways, flexvol.FsGroupChangeOnRootMismatch, flexvol.FsGroupChangeNever} {
+		if strings.EqualFold(policy, p) {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not one of %s, %s or %s", policy, flexvol.FsGroupChangeAlways, flexvol.FsGroupChangeOnRootMismatch, flexvol.FsGroupChangeNever)
+}
+
+func parseSelinuxLabel(label string) (string, error) {
+	for _, l := range []string{flexvol.SelinuxLabelChcon, flexvol.SelinuxLabelContext, flexvol.SelinuxLabelNone} {
+		if strings.EqualFold(label, l) {
+			return l, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not one of %s, %s or %s", label, flexvol.SelinuxLabelChcon, flexvol.SelinuxLabelContext, flexvol.SelinuxLabelNone)
+}
+
+// validateConfig returns the error for each option in c that can't be used, including the options
+// that are missing.  Unlike initialize it doesn't change the configuration or print anything.
+func validateConfig(c *jconfig.Config) map[string]error {
+	errs := make(map[string]error)
+	for _, opt := range []string{optLogFilePath, optReplayLogPath, optDockerVolumePluginSocketPath, optDockerVolumePluginCAFile,
+		optDockerVolumePluginCertFile, optDockerVolumePluginKeyFile, optLockDirectory, optSelinuxType, optSelinuxLevel} {
+		if _, err := c.GetStringWithError(opt); err != nil {
+			errs[opt] = err
+		}
+	}
+	for _, opt := range []string{optDebug, optSupportsCapabilities, optStripK8sFromOptions, optCreateVolumes, optEnable16, optEnableAttach} {
+		if _, err := c.GetBool(opt); err != nil {
+			errs[opt] = err
+		}
+	}
+	for _, opt := range []string{optListOfStorageResourceOptions, optKubeletRootDirs} {
+		if _, err := c.GetStringSliceWithError(opt); err != nil {
+			errs[opt] = err
+		}
+	}
+	for _, opt := range []string{optFactorForConversion, optLockTimeoutSeconds, optRetryMaxTries, optRetryDelaySeconds,
+		optRetryMaxDelaySeconds, optRetryJitterPercent, optRetryDeadlineSeconds} {
+		if _, err := c.GetInt64SliceWithError(opt); err != nil {
+			errs[opt] = err
+		}
+	}
+
+	s, err := c.GetStringWithError(optFsGroupChangePolicy)
+	if err == nil {
+		_, err = parseFsGroupChangePolicy(s)
+	}
+	if err != nil {
+		errs[optFsGroupChangePolicy] = err
+	}
+
+	s, err = c.GetStringWithError(optSelinuxLabel)
+	if err == nil {
+		_, err = parseSelinuxLabel(s)
+	}
+	if err != nil {
+		errs[optSelinuxLabel] = err
 	}
+	return errs
 }
 
 func configOptDump(report bool) {
@@ -214,11 +504,28 @@ func configOptDump(report bool) {
 	}
 	fmt.Printf("\nDriver=%s Version=%s-%s\nCurrent Config:\n", filepath.Base(os.Args[0]), Version, Commit)
 	fmt.Printf("%30s = %s\n", optDockerVolumePluginSocketPath, dockerVolumePluginSocketPath)
+	fmt.Printf("%30s = %s\n", optDockerVolumePluginCAFile, dockerVolumePluginCAFile)
+	fmt.Printf("%30s = %s\n", optDockerVolumePluginCertFile, dockerVolumePluginCertFile)
+	fmt.Printf("%30s = %s\n", optDockerVolumePluginKeyFile, dockerVolumePluginKeyFile)
 	fmt.Printf("%30s = %t\n", optStripK8sFromOptions, stripK8sFromOptions)
 	fmt.Printf("%30s = %s\n", optLogFilePath, logFilePath)
+	fmt.Printf("%30s = %s\n", optReplayLogPath, replayLogPath)
 	fmt.Printf("%30s = %t\n", optDebug, debug)
 	fmt.Printf("%30s = %t\n", optCreateVolumes, createVolumes)
 	fmt.Printf("%30s = %t\n", optEnable16, enable16)
+	fmt.Printf("%30s = %t\n", optEnableAttach, enableAttach)
+	fmt.Printf("%30s = %s\n", optFsGroupChangePolicy, fsGroupChangePolicy)
+	fmt.Printf("%30s = %s\n", optLockDirectory, lockDirectory)
+	fmt.Printf("%30s = %d\n", optLockTimeoutSeconds, lockTimeoutSeconds)
+	fmt.Printf("%30s = %v\n", optKubeletRootDirs, kubeletRootDirs)
+	fmt.Printf("%30s = %s\n", optSelinuxLabel, selinuxLabel)
+	fmt.Printf("%30s = %s\n", optSelinuxType, selinuxType)
+	fmt.Printf("%30s = %s\n", optSelinuxLevel, selinuxLevel)
+	fmt.Printf("%30s = %d\n", optRetryMaxTries, retryMaxTries)
+	fmt.Printf("%30s = %d\n", optRetryDelaySeconds, retryDelaySeconds)
+	fmt.Printf("%30s = %d\n", optRetryMaxDelaySeconds, retryMaxDelaySeconds)
+	fmt.Printf("%30s = %d\n", optRetryJitterPercent, retryJitterPercent)
+	fmt.Printf("%30s = %d\n", optRetryDeadlineSeconds, retryDeadlineSeconds)
 	fmt.Printf("%30s = %d\n", optFactorForConversion, factorForConversion)
 	fmt.Printf("%30s = %v\n", optListOfStorageResourceOptions, listOfStorageResourceOptions)
 	fmt.Printf("%30s = %t\n", optSupportsCapabilities, supportsCapabilities)
@@ -17,6 +17,8 @@ limitations under the License.
 package main
 
 import (
+	"github.com/hpe-storage/dory/common/jconfig"
+	"strings"
 	"testing"
 )
 
@@ -32,11 +34,54 @@ var basicTests = []struct {
 	factorForConversion          int
 	listOfStorageResourceOptions []string
 	supportsCapabilities         bool
+	enableAttach                 bool
+	fsGroupChangePolicy          string
+	lockDirectory                string
+	lockTimeoutSeconds           int
+	kubeletRootDirs              []string
+	selinuxLabel                 string
+	selinuxType                  string
+	selinuxLevel                 string
+	replayLogPath                string
+	retryMaxTries                int
+	retryDelaySeconds            int
+	retryMaxDelaySeconds         int
+	retryJitterPercent           int
+	retryDeadlineSeconds         int
+	dockerVolumePluginCAFile     string
+	dockerVolumePluginCertFile   string
+	dockerVolumePluginKeyFile    string
 }{
-	{"test/good", true, "/run/docker/plugins/nimble.sock", true, "/var/log/dory.log", false, true, false, 1073741824, []string{"size", "sizeInGiB"}, true},
-	{"test/flipped", true, "nimble", false, "some path", true, false, true, 14, []string{"size", "sizeInGiB", "w", "x", "y", "z"}, false},
-	{"test/broken", false, "/run/docker/plugins/nimble.sock", true, "/var/log/dory.log", false, true, false, 1073741824, []string{"size", "sizeInGiB"}, true},
-	{"test/errors", true, "21", true, "true", false, true, false, 1073741824, []string{"size", "sizeInGiB"}, true},
+	{"test/good", true, "/run/docker/plugins/nimble.sock", true, "/var/log/dory.log", false, true, false, 1073741824, []string{"size", "sizeInGiB"}, true, false, "Always", "/var/run/dory", 30, []string{"/var/lib/kubelet", "/var/lib/origin/openshift.local.volumes", "/var/snap/microk8s/common/var/lib/kubelet", "/opt/kubelet"}, "chcon", "svirt_sandbox_file_t", "", "", 4, 1, 8, 20, 90, "", "", ""},
+	{"test/flipped", true, "nimble", false, "some path", true, false, true, 14, []string{"size", "sizeInGiB", "w", "x", "y", "z"}, false, true, "OnRootMismatch", "/tmp/dory", 90, []string{"/opt/kubelet", "/data/kubelet"}, "context", "container_file_t", "s0:c1,c2", "/var/log/dory.replay", 6, 2, 10, 0, 0, "/etc/dory/ca.pem", "/etc/dory/cert.pem", "/etc/dory/key.pem"},
+	{"test/broken", false, "/run/docker/plugins/nimble.sock", true, "/var/log/dory.log", false, true, false, 1073741824, []string{"size", "sizeInGiB"}, true, false, "Always", "/var/run/dory", 30, []string{"/var/lib/kubelet", "/var/lib/origin/openshift.local.volumes", "/var/snap/microk8s/common/var/lib/kubelet", "/opt/kubelet"}, "chcon", "svirt_sandbox_file_t", "", "", 4, 1, 8, 20, 90, "", "", ""},
+	{"test/errors", true, "21", true, "true", false, true, false, 1073741824, []string{"size", "sizeInGiB"}, true, false, "Always", "12", 30, []string{"/var/lib/kubelet", "/var/lib/origin/openshift.local.volumes", "/var/snap/microk8s/common/var/lib/kubelet", "/opt/kubelet"}, "chcon", "7", "42", "false", 4, 1, 8, 20, 90, "1", "2", "3"},
+}
+
+func TestValidateConfig(t *testing.T) {
+	c, err := jconfig.NewConfig("test/errors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := enableAttach
+	errs := validateConfig(c)
+	for _, opt := range []string{optCreateVolumes, optEnableAttach, optFsGroupChangePolicy, optLockTimeoutSeconds, optKubeletRootDirs, optSelinuxLabel} {
+		if errs[opt] == nil {
+			t.Error("expected an error for", opt)
+		}
+	}
+	// numbers and bools are accepted as strings, out of range values are ignored by initialize
+	for _, opt := range []string{optLogFilePath, optSelinuxType, optRetryMaxDelaySeconds, optRetryJitterPercent} {
+		if errs[opt] != nil {
+			t.Error("unexpected error for", opt, errs[opt])
+		}
+	}
+	if errs[optSupportsCapabilities] == nil {
+		t.Error("expected an error for the missing", optSupportsCapabilities)
+	}
+	if enableAttach != saved {
+		t.Error("expected validateConfig not to change enableAttach")
+	}
 }
 
 // nolint: gocyclo
@@ -53,6 +98,23 @@ func TestConfigFiles(t *testing.T) {
 			factorForConversion = 1073741824
 			listOfStorageResourceOptions = []string{"size", "sizeInGiB"}
 			supportsCapabilities = true
+			enableAttach = false
+			fsGroupChangePolicy = "Always"
+			lockDirectory = "/var/run/dory"
+			lockTimeoutSeconds = 30
+			kubeletRootDirs = []string{"/var/lib/kubelet", "/var/lib/origin/openshift.local.volumes", "/var/snap/microk8s/common/var/lib/kubelet", "/opt/kubelet"}
+			selinuxLabel = "chcon"
+			selinuxType = "svirt_sandbox_file_t"
+			selinuxLevel = ""
+			replayLogPath = ""
+			retryMaxTries = 4
+			retryDelaySeconds = 1
+			retryMaxDelaySeconds = 8
+			retryJitterPercent = 20
+			retryDeadlineSeconds = 90
+			dockerVolumePluginCAFile = ""
+			dockerVolumePluginCertFile = ""
+			dockerVolumePluginKeyFile = ""
 
 			override := initialize(tc.name, true)
 			if override != tc.override {
@@ -125,6 +187,125 @@ func TestConfigFiles(t *testing.T) {
 					"got:", supportsCapabilities,
 				)
 			}
+			if enableAttach != tc.enableAttach {
+				t.Error(
+					"For", "enableAttach",
+					"expected", tc.enableAttach,
+					"got:", enableAttach,
+				)
+			}
+			if fsGroupChangePolicy != tc.fsGroupChangePolicy {
+				t.Error(
+					"For", "fsGroupChangePolicy",
+					"expected", tc.fsGroupChangePolicy,
+					"got:", fsGroupChangePolicy,
+				)
+			}
+			if lockDirectory != tc.lockDirectory {
+				t.Error(
+					"For", "lockDirectory",
+					"expected", tc.lockDirectory,
+					"got:", lockDirectory,
+				)
+			}
+			if lockTimeoutSeconds != tc.lockTimeoutSeconds {
+				t.Error(
+					"For", "lockTimeoutSeconds",
+					"expected", tc.lockTimeoutSeconds,
+					"got:", lockTimeoutSeconds,
+				)
+			}
+			if strings.Join(kubeletRootDirs, ",") != strings.Join(tc.kubeletRootDirs, ",") {
+				t.Error(
+					"For", "kubeletRootDirs",
+					"expected", tc.kubeletRootDirs,
+					"got:", kubeletRootDirs,
+				)
+			}
+			if selinuxLabel != tc.selinuxLabel {
+				t.Error(
+					"For", "selinuxLabel",
+					"expected", tc.selinuxLabel,
+					"got:", selinuxLabel,
+				)
+			}
+			if selinuxType != tc.selinuxType {
+				t.Error(
+					"For", "selinuxType",
+					"expected", tc.selinuxType,
+					"got:", selinuxType,
+				)
+			}
+			if selinuxLevel != tc.selinuxLevel {
+				t.Error(
+					"For", "selinuxLevel",
+					"expected", tc.selinuxLevel,
+					"got:", selinuxLevel,
+				)
+			}
+			if replayLogPath != tc.replayLogPath {
+				t.Error(
+					"For", "replayLogPath",
+					"expected", tc.replayLogPath,
+					"got:", replayLogPath,
+				)
+			}
+			if retryMaxTries != tc.retryMaxTries {
+				t.Error(
+					"For", "retryMaxTries",
+					"expected", tc.retryMaxTries,
+					"got:", retryMaxTries,
+				)
+			}
+			if retryDelaySeconds != tc.retryDelaySeconds {
+				t.Error(
+					"For", "retryDelaySeconds",
+					"expected", tc.retryDelaySeconds,
+					"got:", retryDelaySeconds,
+				)
+			}
+			if retryMaxDelaySeconds != tc.retryMaxDelaySeconds {
+				t.Error(
+					"For", "retryMaxDelaySeconds",
+					"expected", tc.retryMaxDelaySeconds,
+					"got:", retryMaxDelaySeconds,
+				)
+			}
+			if retryJitterPercent != tc.retryJitterPercent {
+				t.Error(
+					"For", "retryJitterPercent",
+					"expected", tc.retryJitterPercent,
+					"got:", retryJitterPercent,
+				)
+			}
+			if retryDeadlineSeconds != tc.retryDeadlineSeconds {
+				t.Error(
+					"For", "retryDeadlineSeconds",
+					"expected", tc.retryDeadlineSeconds,
+					"got:", retryDeadlineSeconds,
+				)
+			}
+			if dockerVolumePluginCAFile != tc.dockerVolumePluginCAFile {
+				t.Error(
+					"For", "dockerVolumePluginCAFile",
+					"expected", tc.dockerVolumePluginCAFile,
+					"got:", dockerVolumePluginCAFile,
+				)
+			}
+			if dockerVolumePluginCertFile != tc.dockerVolumePluginCertFile {
+				t.Error(
+					"For", "dockerVolumePluginCertFile",
+					"expected", tc.dockerVolumePluginCertFile,
+					"got:", dockerVolumePluginCertFile,
+				)
+			}
+			if dockerVolumePluginKeyFile != tc.dockerVolumePluginKeyFile {
+				t.Error(
+					"For", "dockerVolumePluginKeyFile",
+					"expected", tc.dockerVolumePluginKeyFile,
+					"got:", dockerVolumePluginKeyFile,
+				)
+			}
 		})
 	}
 }
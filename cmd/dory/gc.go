@@ -0,0 +1,109 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	flexvol "github.com/hpe-storage/dory/common/k8s/flexvol"
+	"github.com/hpe-storage/dory/common/util"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	cmdGC = "gc"
+	//podUIDLabel is the label kubelet puts on the sandbox and containers of a pod
+	podUIDLabel = "io.kubernetes.pod.uid"
+	crictlCmd   = "crictl"
+	dockerCmd   = "docker"
+)
+
+//gcReport is printed by the gc command
+type gcReport struct {
+	Driver  string            `json:"driver"`
+	DryRun  bool              `json:"dryRun"`
+	Orphans []*flexvol.Orphan `json:"orphans"`
+}
+
+// gc cleans up the mounts, directories, journal entries and breadcrumbs left behind by pods
+// that no longer exist and prints a json report.
+// usage: dory gc [-dryRun] [-minAge duration]
+func gc(name string, args []string) error {
+	flags := flag.NewFlagSet(cmdGC, flag.ContinueOnError)
+	dryRun := flags.Bool("dryRun", false, "only report what would be cleaned up")
+	minAge := flags.Duration("minAge", 10*time.Minute, "leave mounts made more recently than this alone")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	initialize(name, false)
+	util.OpenLogFile(logFilePath, 10, 4, 90, debug)
+	defer util.CloseLogFile()
+
+	err := flexvol.Config(name, getDockervolOptions(), getFlexvolOptions())
+	if err != nil {
+		if !*dryRun {
+			return fmt.Errorf("unable to communicate with docker volume plugin - %s", err.Error())
+		}
+		util.LogInfo.Printf("unable to communicate with docker volume plugin, not required for a dry run - %s", err.Error())
+	}
+
+	orphans, err := flexvol.CollectGarbage(&flexvol.GCOptions{
+		DryRun:    *dryRun,
+		MinAge:    *minAge,
+		PodExists: podExists,
+	})
+	if err != nil {
+		return err
+	}
+
+	report := &gcReport{Driver: filepath.Base(name), DryRun: *dryRun, Orphans: orphans}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+
+	for _, orphan := range orphans {
+		if orphan.Error != "" {
+			return fmt.Errorf("unable to clean up %s", orphan.Path)
+		}
+	}
+	return nil
+}
+
+// podExists asks the container runtime for the pod's sandbox, which kubelet keeps, running or not,
+// until the pod is removed.  crictl is used if it's installed so containerd and CRI-O nodes work,
+// docker is asked for the pod's containers otherwise.
+func podExists(podUID string) (bool, error) {
+	label := fmt.Sprintf("%s=%s", podUIDLabel, podUID)
+	var out string
+	var err error
+	if _, lookErr := exec.LookPath(crictlCmd); lookErr == nil {
+		out, _, err = util.ExecCommandOutput(crictlCmd, []string{"pods", "-q", "--label", label})
+	} else {
+		out, _, err = util.ExecCommandOutput(dockerCmd, []string{"ps", "-a", "-q", "--filter", "label=" + label})
+	}
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(out) != "", nil
+}
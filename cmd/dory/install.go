@@ -0,0 +1,245 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/hpe-storage/dory/common/jconfig"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	cmdInstall   = "install"
+	cmdUninstall = "uninstall"
+	//defaultPluginDir is where kubelet looks for flexvolume drivers
+	defaultPluginDir = "/usr/libexec/kubernetes/kubelet-plugins/volume/exec"
+)
+
+//setValues collects the repeated -set key=value flags
+type setValues []string
+
+func (s *setValues) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *setValues) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("%s is not in the form key=value", value)
+	}
+	*s = append(*s, value)
+	return nil
+}
+
+//installation describes where a driver is installed
+type installation struct {
+	pluginDir string
+	vendor    string
+	driver    string
+}
+
+func newInstallation(name, pluginDir string) (*installation, error) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("driver name %q must be in the form vendor/driver", name)
+	}
+	return &installation{pluginDir: pluginDir, vendor: parts[0], driver: parts[1]}, nil
+}
+
+// dir returns <plugin dir>/<vendor>~<driver>
+func (i *installation) dir() string {
+	return filepath.Join(i.pluginDir, i.vendor+"~"+i.driver)
+}
+
+func (i *installation) binaryPath() string {
+	return filepath.Join(i.dir(), i.driver)
+}
+
+func (i *installation) configPath() string {
+	return i.binaryPath() + ".json"
+}
+
+// install copies this executable and a validated config into the plugin directory.
+// usage: dory install -driver vendor/driver [-pluginDir dir] [-config file] [-set key=value]...
+func install(args []string) error {
+	var sets setValues
+	flags := flag.NewFlagSet(cmdInstall, flag.ContinueOnError)
+	name := flags.String("driver", "", "vendor/driver name of the flexvolume driver")
+	pluginDir := flags.String("pluginDir", defaultPluginDir, "kubelet flexvolume plugin directory")
+	configFile := flags.String("config", "", "json file with the initial driver config")
+	flags.Var(&sets, "set", "config value in the form key=value, may be repeated")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	inst, err := newInstallation(*name, *pluginDir)
+	if err != nil {
+		return err
+	}
+
+	config, err := buildInstallConfig(*configFile, sets)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(inst.dir(), 0755)
+	if err != nil {
+		return err
+	}
+
+	err = installConfig(inst, config)
+	if err != nil {
+		return err
+	}
+
+	err = installBinary(inst)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Installed %s/%s in %s\n", inst.vendor, inst.driver, inst.dir())
+	return nil
+}
+
+// uninstall removes the driver and its config.  The directory is removed if nothing else is left in it.
+// usage: dory uninstall -driver vendor/driver [-pluginDir dir]
+func uninstall(args []string) error {
+	flags := flag.NewFlagSet(cmdUninstall, flag.ContinueOnError)
+	name := flags.String("driver", "", "vendor/driver name of the flexvolume driver")
+	pluginDir := flags.String("pluginDir", defaultPluginDir, "kubelet flexvolume plugin directory")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	inst, err := newInstallation(*name, *pluginDir)
+	if err != nil {
+		return err
+	}
+
+	// remove the binary first so kubelet stops calling the driver
+	for _, path := range []string{inst.binaryPath(), inst.configPath()} {
+		err = os.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	err = os.Remove(inst.dir())
+	if err != nil && !os.IsNotExist(err) {
+		// the mount journal and other state are left in place for volumes that are still mounted
+		fmt.Printf("Leaving %s in place - %s\n", inst.dir(), err.Error())
+	}
+	fmt.Printf("Uninstalled %s/%s from %s\n", inst.vendor, inst.driver, inst.pluginDir)
+	return nil
+}
+
+// buildInstallConfig reads configFile (if provided) and applies sets on top of it.  Values that
+// parse as json (numbers, booleans, arrays) are stored as such, anything else is a string.
+func buildInstallConfig(configFile string, sets []string) (map[string]interface{}, error) {
+	config := make(map[string]interface{})
+	if configFile != "" {
+		data, err := ioutil.ReadFile(configFile)
+		if err != nil {
+			return nil, err
+		}
+		err = json.Unmarshal(data, &config)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s - %s", configFile, err.Error())
+		}
+	}
+
+	for _, set := range sets {
+		kv := strings.SplitN(set, "=", 2)
+		var value interface{}
+		if err := json.Unmarshal([]byte(kv[1]), &value); err != nil {
+			value = kv[1]
+		}
+		config[kv[0]] = value
+	}
+	return config, nil
+}
+
+// installConfig writes config to a temporary file, validates it and renames it into place.
+func installConfig(inst *installation, config map[string]interface{}) error {
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	tmpPath := filepath.Join(inst.dir(), "."+inst.driver+".install.json")
+	err = ioutil.WriteFile(tmpPath, data, 0644)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	c, err := jconfig.NewConfig(tmpPath)
+	if err != nil {
+		return err
+	}
+	// options that aren't in the config just use their defaults
+	errs := validateConfig(c)
+	for key := range config {
+		if err, found := errs[key]; found {
+			return fmt.Errorf("invalid value for %s - %s", key, err.Error())
+		}
+	}
+
+	return os.Rename(tmpPath, inst.configPath())
+}
+
+// installBinary copies this executable next to the config and renames it into place so kubelet
+// never sees a partially written driver.
+func installBinary(inst *installation) error {
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if self == inst.binaryPath() {
+		return nil
+	}
+
+	src, err := os.Open(self)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := filepath.Join(inst.dir(), "."+inst.driver+".install")
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	_, err = io.Copy(dst, src)
+	if err == nil {
+		err = dst.Sync()
+	}
+	closeErr := dst.Close()
+	if err != nil {
+		return err
+	}
+	if closeErr != nil {
+		return closeErr
+	}
+
+	return os.Rename(tmpPath, inst.binaryPath())
+}
@@ -0,0 +1,92 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestInstallUninstall(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = install([]string{"-driver", "hpe/nimble", "-pluginDir", dir, "-config", "test/good.json",
+		"-set", "enableAttach=true", "-set", "logFilePath=/var/log/nimble.log"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "hpe~nimble", "nimble"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0111 == 0 {
+		t.Error("expected the driver to be executable got", info.Mode())
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "hpe~nimble", "nimble.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := make(map[string]interface{})
+	if err = json.Unmarshal(data, &config); err != nil {
+		t.Fatal(err)
+	}
+	if config["enableAttach"] != true || config["logFilePath"] != "/var/log/nimble.log" || config["factorForConversion"] != float64(1073741824) {
+		t.Error("unexpected config", config)
+	}
+	// validating the installed config leaves this process's config alone
+	if enableAttach || logFilePath == "/var/log/nimble.log" {
+		t.Errorf("expected install not to change the config got enableAttach=%t logFilePath=%s", enableAttach, logFilePath)
+	}
+
+	err = uninstall([]string{"-driver", "hpe/nimble", "-pluginDir", dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = os.Stat(filepath.Join(dir, "hpe~nimble")); !os.IsNotExist(err) {
+		t.Error("expected the driver directory to be removed got", err)
+	}
+}
+
+func TestInstallInvalidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = install([]string{"-driver", "hpe/nimble", "-pluginDir", dir, "-set", "enableAttach=oops"})
+	if err == nil {
+		t.Error("expected install to fail for enableAttach=oops")
+	}
+	if _, err = os.Stat(filepath.Join(dir, "hpe~nimble", "nimble.json")); !os.IsNotExist(err) {
+		t.Error("expected no config to be installed got", err)
+	}
+
+	err = install([]string{"-driver", "nimble", "-pluginDir", dir})
+	if err == nil {
+		t.Error("expected install to fail without a vendor")
+	}
+}
@@ -0,0 +1,355 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/hpe-storage/dory/common/connectivity"
+	flexvol "github.com/hpe-storage/dory/common/k8s/flexvol"
+	"github.com/hpe-storage/dory/common/util"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	cmdReplay = "replay"
+	//replayStubSocket is the name of the stub plugin's socket in the replay directory
+	replayStubSocket = "plugin.sock"
+	//maxReplayRecordSize limits the size of a single line in the replay log
+	maxReplayRecordSize = 16 * 1024 * 1024
+)
+
+//replayEnv lists the environment variables that are recorded, the rest may hold credentials
+var replayEnv = []string{"PATH", "LANG", "LC_ALL", "DOCKER_HOST"}
+
+//replayRecord is appended to the replay log for every invocation when replayLogPath is set
+type replayRecord struct {
+	Time      time.Time                `json:"time"`
+	Driver    string                   `json:"driver"`
+	Version   string                   `json:"version"`
+	Command   string                   `json:"command"`
+	Args      []string                 `json:"args"`
+	Env       []string                 `json:"env"`
+	Config    map[string]interface{}   `json:"config"`
+	Exchanges []*connectivity.Exchange `json:"exchanges"`
+	Response  json.RawMessage          `json:"response"`
+}
+
+// newReplayRecord starts recording the exchanges with the plugin for this invocation
+func newReplayRecord(name, driverCommand string, args []string) *replayRecord {
+	record := &replayRecord{
+		Time:      time.Now(),
+		Driver:    filepath.Base(name),
+		Version:   fmt.Sprintf("%s-%s", Version, Commit),
+		Command:   driverCommand,
+		Env:       getReplayEnv(),
+		Config:    getCurrentConfig(),
+		Exchanges: []*connectivity.Exchange{},
+	}
+	for _, arg := range args {
+		record.Args = append(record.Args, util.RedactSecrets(arg))
+	}
+	connectivity.SetRecorder(func(exchange *connectivity.Exchange) {
+		// the plugin may echo secrets back, e.g. in the options of a volume
+		exchange.Response = util.RedactSecrets(exchange.Response)
+		exchange.Error = util.RedactSecrets(exchange.Error)
+		record.Exchanges = append(record.Exchanges, exchange)
+	})
+	return record
+}
+
+// getReplayEnv returns the variables in replayEnv that are set
+func getReplayEnv() []string {
+	var env []string
+	for _, key := range replayEnv {
+		if value, found := os.LookupEnv(key); found {
+			env = append(env, key+"="+value)
+		}
+	}
+	return env
+}
+
+// finish stops recording and appends the record with its response to the replay log
+func (r *replayRecord) finish(replayLog, response string) error {
+	connectivity.SetRecorder(nil)
+	r.Response = json.RawMessage(response)
+	data, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+
+	// the environment and config may be sensitive
+	file, err := os.OpenFile(replayLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// a single write keeps records from concurrent invocations on their own lines
+	_, err = file.Write(append(data, '\n'))
+	return err
+}
+
+//getCurrentConfig returns every option with its current value
+func getCurrentConfig() map[string]interface{} {
+	return map[string]interface{}{
+		optDockerVolumePluginSocketPath: dockerVolumePluginSocketPath,
+		optDockerVolumePluginCAFile:     dockerVolumePluginCAFile,
+		optDockerVolumePluginCertFile:   dockerVolumePluginCertFile,
+		optDockerVolumePluginKeyFile:    dockerVolumePluginKeyFile,
+		optStripK8sFromOptions:          stripK8sFromOptions,
+		optLogFilePath:                  logFilePath,
+		optDebug:                        debug,
+		optCreateVolumes:                createVolumes,
+		optEnable16:                     enable16,
+		optEnableAttach:                 enableAttach,
+		optFsGroupChangePolicy:          fsGroupChangePolicy,
+		optLockDirectory:                lockDirectory,
+		optLockTimeoutSeconds:           lockTimeoutSeconds,
+		optKubeletRootDirs:              kubeletRootDirs,
+		optSelinuxLabel:                 selinuxLabel,
+		optSelinuxType:                  selinuxType,
+		optSelinuxLevel:                 selinuxLevel,
+		optRetryMaxTries:                retryMaxTries,
+		optRetryDelaySeconds:            retryDelaySeconds,
+		optRetryMaxDelaySeconds:         retryMaxDelaySeconds,
+		optRetryJitterPercent:           retryJitterPercent,
+		optRetryDeadlineSeconds:         retryDeadlineSeconds,
+		optReplayLogPath:                replayLogPath,
+		optFactorForConversion:          factorForConversion,
+		optListOfStorageResourceOptions: listOfStorageResourceOptions,
+		optSupportsCapabilities:         supportsCapabilities,
+	}
+}
+
+// replay runs the invocations in a replay log against a stub plugin that answers with the recorded
+// exchanges.  It returns an error if any invocation didn't reproduce.
+// usage: dory replay -log file [-record n] [-debug]
+func replay(args []string) error {
+	flags := flag.NewFlagSet(cmdReplay, flag.ContinueOnError)
+	replayLog := flags.String("log", "", "replay log to read")
+	index := flags.Int("record", 0, "replay only this record (counting from 1)")
+	logDebug := flags.Bool("debug", false, "log debug messages to stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *replayLog == "" {
+		return fmt.Errorf("-log is required")
+	}
+	util.OpenLog(*logDebug)
+
+	records, err := readReplayLog(*replayLog)
+	if err != nil {
+		return err
+	}
+	if *index < 0 || *index > len(records) {
+		return fmt.Errorf("%s only has %d records", *replayLog, len(records))
+	}
+
+	failed := 0
+	for i, record := range records {
+		if *index != 0 && *index != i+1 {
+			continue
+		}
+		problems, err := replayOne(record)
+		if err != nil {
+			return err
+		}
+		if len(problems) > 0 {
+			failed++
+			fmt.Printf("record %d: %s %v FAILED\n", i+1, record.Command, record.Args)
+			for _, problem := range problems {
+				fmt.Printf("    %s\n", problem)
+			}
+			continue
+		}
+		fmt.Printf("record %d: %s %v ok\n", i+1, record.Command, record.Args)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d records didn't reproduce", failed)
+	}
+	return nil
+}
+
+func readReplayLog(replayLog string) ([]*replayRecord, error) {
+	file, err := os.Open(replayLog)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*replayRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxReplayRecordSize)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		record := &replayRecord{}
+		err = json.Unmarshal([]byte(line), record)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse record %d in %s - %s", len(records)+1, replayLog, err.Error())
+		}
+		records = append(records, record)
+	}
+	return records, scanner.Err()
+}
+
+// replayOne runs a single invocation in a scratch directory, so the mount journal, locks and
+// config don't touch the node's.  The problems found are returned.
+func replayOne(record *replayRecord) ([]string, error) {
+	dir, err := ioutil.TempDir("", "dory-replay")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	stub := &stubPlugin{exchanges: record.Exchanges}
+	socket := filepath.Join(dir, replayStubSocket)
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		return nil, err
+	}
+	server := &http.Server{Handler: stub}
+	go server.Serve(listener)
+	defer server.Close()
+
+	config := make(map[string]interface{})
+	for key, value := range record.Config {
+		config[key] = value
+	}
+	config[optDockerVolumePluginSocketPath] = socket
+	config[optLockDirectory] = dir
+	config[optReplayLogPath] = ""
+	data, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+	name := filepath.Join(dir, record.Driver)
+	err = ioutil.WriteFile(name+".json", data, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, env := range record.Env {
+		kv := strings.SplitN(env, "=", 2)
+		if len(kv) == 2 {
+			os.Setenv(kv[0], kv[1])
+		}
+	}
+
+	initialize(name, false)
+	response := run(name, record.Command, record.Args)
+
+	problems := stub.getProblems()
+	return append(problems, compareResponses(record.Response, response)...), nil
+}
+
+// compareResponses compares everything but the message, which may contain paths that differ
+// between the node and the replay.  A different message is only noted if the rest matches.
+func compareResponses(recorded json.RawMessage, replayed string) []string {
+	want := &flexvol.Response{}
+	err := json.Unmarshal(recorded, want)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to parse the recorded response %s - %s", string(recorded), err.Error())}
+	}
+	got := &flexvol.Response{}
+	err = json.Unmarshal([]byte(replayed), got)
+	if err != nil {
+		return []string{fmt.Sprintf("unable to parse the replayed response %s - %s", replayed, err.Error())}
+	}
+
+	wantMessage, gotMessage := want.Message, got.Message
+	want.Message, got.Message = "", ""
+	if flexvol.BuildJSONResponse(want) != flexvol.BuildJSONResponse(got) {
+		return []string{fmt.Sprintf("expected response %s got %s", string(recorded), replayed)}
+	}
+	if wantMessage != gotMessage {
+		fmt.Printf("    note: expected message %q got %q\n", wantMessage, gotMessage)
+	}
+	return nil
+}
+
+//stubPlugin answers requests with the recorded exchanges in order
+type stubPlugin struct {
+	mutex     sync.Mutex
+	exchanges []*connectivity.Exchange
+	next      int
+	//failures is the number of failed attempts served for the next exchange
+	failures int
+	problems []string
+}
+
+func (s *stubPlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.next >= len(s.exchanges) {
+		s.problems = append(s.problems, fmt.Sprintf("unexpected request %s %s", r.Method, r.URL.Path))
+		http.Error(w, "{\"Err\":\"unexpected request\"}", http.StatusInternalServerError)
+		return
+	}
+	exchange := s.exchanges[s.next]
+	if exchange.Action != r.Method || exchange.Path != r.URL.Path {
+		s.problems = append(s.problems, fmt.Sprintf("expected request %s %s got %s %s", exchange.Action, exchange.Path, r.Method, r.URL.Path))
+		http.Error(w, "{\"Err\":\"unexpected request\"}", http.StatusInternalServerError)
+		return
+	}
+
+	// attempts that failed are reproduced by dropping the connection
+	if exchange.StatusCode == 0 || s.failures < exchange.Attempts-1 {
+		s.failures++
+		if s.failures >= exchange.Attempts {
+			s.next++
+			s.failures = 0
+		}
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		http.Error(w, exchange.Error, http.StatusInternalServerError)
+		return
+	}
+
+	s.next++
+	s.failures = 0
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(exchange.StatusCode)
+	fmt.Fprint(w, exchange.Response)
+}
+
+// getProblems returns the unexpected requests and any exchanges that weren't requested
+func (s *stubPlugin) getProblems() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	problems := s.problems
+	for _, exchange := range s.exchanges[s.next:] {
+		problems = append(problems, fmt.Sprintf("expected request %s %s wasn't made", exchange.Action, exchange.Path))
+	}
+	return problems
+}
@@ -0,0 +1,102 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"github.com/hpe-storage/dory/common/connectivity"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	record := &replayRecord{
+		Driver:  "nimble",
+		Command: "attach",
+		Args:    []string{`{"kubernetes.io/fsType":"xfs","name":"vol1"}`},
+		Config: map[string]interface{}{
+			optEnableAttach:         false,
+			optEnable16:             false,
+			optCreateVolumes:        true,
+			optSupportsCapabilities: true,
+		},
+		Exchanges: []*connectivity.Exchange{
+			{Action: "POST", Path: "/Plugin.Activate", Attempts: 1, StatusCode: 200, Response: `{"Implements":["VolumeDriver"]}`},
+			{Action: "POST", Path: "/VolumeDriver.Capabilities", Attempts: 1, StatusCode: 200, Response: `{"Capabilities":{"Scope":"global"}}`},
+			{Action: "POST", Path: "/VolumeDriver.Get", Attempts: 1, StatusCode: 200, Response: `{"Volume":{"Name":"vol1","Mountpoint":""},"Err":""}`},
+		},
+		Response: json.RawMessage(`{"status":"Not supported","message":"Not supported."}`),
+	}
+	replayLog := filepath.Join(dir, "dory.replay")
+	data, _ := json.Marshal(record)
+	err = ioutil.WriteFile(replayLog, append(data, '\n'), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = replay([]string{"-log", replayLog})
+	if err != nil {
+		t.Error("expected the record to reproduce got", err)
+	}
+
+	// a different volume is found, so the driver will try to create vol1
+	record.Exchanges[2].Response = `{"Volume":{"Name":"vol2","Mountpoint":""},"Err":""}`
+	data, _ = json.Marshal(record)
+	err = ioutil.WriteFile(replayLog, append(data, '\n'), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = replay([]string{"-log", replayLog, "-record", "1"})
+	if err == nil {
+		t.Error("expected the record not to reproduce")
+	}
+}
+
+func TestNewReplayRecordRedacts(t *testing.T) {
+	os.Setenv("DORY_TEST_TOKEN", "hunter2")
+	defer os.Unsetenv("DORY_TEST_TOKEN")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Volume":{"Name":"vol1","Status":{"kubernetes.io/secret/password":"hunter2"}}}`))
+	}))
+	defer server.Close()
+
+	record := newReplayRecord("nimble", "mount", []string{`{"kubernetes.io/secret/password":"hunter2"}`})
+	err := connectivity.NewHTTPClient(server.URL).DoJSON(&connectivity.Request{Action: "POST", Path: "/VolumeDriver.Get", Response: &struct{}{}})
+	connectivity.SetRecorder(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _ := json.Marshal(record)
+	if strings.Contains(string(data), "hunter2") {
+		t.Error("expected the secrets to be redacted from", string(data))
+	}
+	if len(record.Exchanges) != 1 || !strings.Contains(record.Exchanges[0].Response, "kubernetes.io/secret/password") {
+		t.Errorf("expected the redacted response to be recorded got %+v", record.Exchanges)
+	}
+}
@@ -18,10 +18,12 @@ package connectivity
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/hpe-storage/dory/common/util"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
 	"strings"
@@ -46,10 +48,51 @@ type Request struct {
 	ResponseError interface{}
 }
 
+//Exchange records a request made by DoJSON and the response it received
+type Exchange struct {
+	Action string `json:"action"`
+	//Path is the URI without the client's prefix
+	Path string `json:"path"`
+	//Payload is the json sent with secrets redacted
+	Payload string `json:"payload,omitempty"`
+	//Attempts is the number of times the request was sent
+	Attempts int `json:"attempts"`
+	//StatusCode is 0 if no response was received
+	StatusCode int    `json:"statusCode,omitempty"`
+	Response   string `json:"response,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+//ConnectionError is returned when a request didn't get a response from the server
+type ConnectionError struct {
+	Err error
+}
+
+func (e *ConnectionError) Error() string {
+	return e.Err.Error()
+}
+
+//Timeout returns true if the server didn't respond in time
+func (e *ConnectionError) Timeout() bool {
+	timeout, ok := e.Err.(interface {
+		Timeout() bool
+	})
+	return ok && timeout.Timeout()
+}
+
+//recorder is called with each exchange when set
+var recorder func(*Exchange)
+
+//SetRecorder causes DoJSON to call record with every exchange.  Passing nil stops recording.
+func SetRecorder(record func(*Exchange)) {
+	recorder = record
+}
+
 // Client is a simple wrapper for http.Client
 type Client struct {
 	*http.Client
-	pathPrefix string
+	pathPrefix  string
+	retryPolicy *util.RetryPolicy
 }
 
 // NewHTTPClient returns a client that communicates over ip using a 30 second timeout
@@ -62,7 +105,7 @@ func NewHTTPClientWithTimeout(url string, timeout time.Duration) *Client {
 	if timeout < 1 {
 		timeout = defaultTimeout
 	}
-	return &Client{&http.Client{Timeout: timeout}, url}
+	return &Client{Client: &http.Client{Timeout: timeout}, pathPrefix: url}
 }
 
 // NewHTTPSClientWithTimeout returns a client that communicates over ip with tls :
@@ -70,7 +113,7 @@ func NewHTTPSClientWithTimeout(url string, transport http.RoundTripper, timeout
 	if timeout < 1 {
 		timeout = defaultTimeout
 	}
-	return &Client{&http.Client{Timeout: timeout, Transport: transport}, url}
+	return &Client{Client: &http.Client{Timeout: timeout, Transport: transport}, pathPrefix: url}
 }
 
 // NewHTTPSClient returns a new https client
@@ -94,13 +137,26 @@ func NewSocketClientWithTimeout(filename string, timeout time.Duration) *Client
 	tr.Dial = func(_, _ string) (net.Conn, error) {
 		return net.DialTimeout("unix", filename, timeout)
 	}
-	return &Client{&http.Client{Transport: tr, Timeout: timeout}, "http://unix"}
+	return &Client{Client: &http.Client{Transport: tr, Timeout: timeout}, pathPrefix: "http://unix"}
+}
+
+// SetRetryPolicy sets the policy used to retry requests that fail to get a response.  util.DefaultRetryPolicy
+// is used if policy is nil.
+func (client *Client) SetRetryPolicy(policy *util.RetryPolicy) {
+	client.retryPolicy = policy
 }
 
 // DoJSON action on path.  payload and response are expected to be structs that decode/encode from/to json
 // Example action=POST, path=/VolumeDriver.Create ...
-// Tries 3 times to get data from the server
+// Failures to get a response are retried using the client's retry policy and returned as a *ConnectionError.
+// The request is abandoned when the policy's deadline passes, even if the client's timeout is longer.
 func (client *Client) DoJSON(r *Request) error {
+	var exchange *Exchange
+	if recorder != nil {
+		exchange = &Exchange{Action: r.Action, Path: r.Path}
+		defer recorder(exchange)
+	}
+
 	// make sure we have a root slash
 	if !strings.HasPrefix(r.Path, "/") {
 		r.Path = client.pathPrefix + "/" + r.Path
@@ -123,15 +179,43 @@ func (client *Client) DoJSON(r *Request) error {
 	}
 	req.Header.Add("Accept", "application/json")
 	req.Close = true
-	util.LogDebug.Printf("request: action=%s path=%s payload=%s", r.Action, r.Path, buf.String())
+	// each attempt, and reading the response, only gets what's left before the retry deadline
+	if deadline := client.retryPolicy.GetDeadline(time.Now()); !deadline.IsZero() {
+		ctx, cancel := context.WithDeadline(req.Context(), deadline)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	util.LogDebug.Printf("request: action=%s path=%s payload=%s", r.Action, r.Path, util.RedactSecrets(buf.String()))
+	if exchange != nil {
+		exchange.Payload = strings.TrimSpace(util.RedactSecrets(buf.String()))
+	}
 
 	// execute the do
-	res, err := doWithRetry(client, req)
+	res, attempts, err := doWithRetry(client, req)
+	if exchange != nil {
+		exchange.Attempts = attempts
+		if err != nil {
+			exchange.Error = err.Error()
+		}
+	}
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 
+	if exchange != nil {
+		// keep a copy of the body for the recorder
+		var body []byte
+		body, err = ioutil.ReadAll(res.Body)
+		if err != nil {
+			exchange.Error = err.Error()
+			return err
+		}
+		exchange.StatusCode = res.StatusCode
+		exchange.Response = string(body)
+		res.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
 	// check the status code
 	if res.StatusCode != http.StatusOK && res.StatusCode != http.StatusCreated {
 		//decode the body into the error response
@@ -152,22 +236,33 @@ func (client *Client) DoJSON(r *Request) error {
 	return nil
 }
 
-func doWithRetry(client *Client, request *http.Request) (*http.Response, error) {
-	try := 0
-	maxTries := 3
-	for {
-		response, err := client.Do(request)
-		if err != nil {
-			if try < maxTries {
-				try++
-				time.Sleep(time.Duration(try) * time.Second)
-				continue
+// doWithRetry returns the response along with the number of attempts made.  Failures to get a
+// response are returned as a *ConnectionError.
+func doWithRetry(client *Client, request *http.Request) (*http.Response, int, error) {
+	var response *http.Response
+	attempts := 0
+	err := client.retryPolicy.Do(request.Method+" "+request.URL.String(), func(try int) error {
+		attempts = try
+		if try > 1 && request.GetBody != nil {
+			// the body was consumed by the previous try
+			body, err := request.GetBody()
+			if err != nil {
+				return err
 			}
-			return nil, err
+			request.Body = body
 		}
-		util.LogDebug.Printf("response: %v, length=%v", response.Status, response.ContentLength)
-		return response, nil
+		var err error
+		response, err = client.Do(request)
+		if err != nil {
+			return &ConnectionError{Err: err}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, attempts, err
 	}
+	util.LogDebug.Printf("response: %v, length=%v", response.Status, response.ContentLength)
+	return response, attempts, nil
 }
 
 func decode(rc io.ReadCloser, dest interface{}, r *Request) error {
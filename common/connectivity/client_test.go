@@ -17,6 +17,7 @@ package connectivity
 
 import (
 	"fmt"
+	"github.com/hpe-storage/dory/common/util"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -28,6 +29,7 @@ import (
 const (
 	socket      = "socket.socket"
 	socket2     = "socket2.socket"
+	socket3     = "socket3.socket"
 	requestJSON = "{\"ping\":\"junk\"}\n"
 	pathString  = "/woohoo"
 )
@@ -136,10 +138,10 @@ func TestSocketTimeout(t *testing.T) {
 	client := NewSocketClientWithTimeout(socket2, time.Millisecond)
 	var foo answer
 	err = client.DoJSON(&Request{"POST", pathString, &question{Ping: "junk"}, &foo, nil})
-	if err == nil {
+	if connErr, ok := err.(*ConnectionError); !ok || !connErr.Timeout() {
 		t.Error(
 			"client post expected to timeout",
-			"error: was nil",
+			"got error:", err,
 		)
 	}
 
@@ -149,6 +151,64 @@ func TestSocketTimeout(t *testing.T) {
 	verifyFoo(err, foo, t)
 }
 
+func TestSocketRetryDeadline(t *testing.T) {
+	os.Remove(socket3)
+	defer os.Remove(socket3)
+	server := http.Server{}
+	server.Handler = &testTimeoutHandler{t: t}
+	unixListener, err := net.Listen("unix", socket3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(unixListener)
+	defer server.Close()
+
+	// the deadline cuts the request off well before the client's timeout
+	client := NewSocketClient(socket3)
+	client.SetRetryPolicy(&util.RetryPolicy{MaxTries: 3, Delay: time.Millisecond, Deadline: time.Now().Add(100 * time.Millisecond)})
+	start := time.Now()
+	var foo answer
+	err = client.DoJSON(&Request{"POST", pathString, &question{Ping: "junk"}, &foo, nil})
+	if connErr, ok := err.(*ConnectionError); !ok || !connErr.Timeout() {
+		t.Error("expected the request to time out got", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error("expected the deadline to stop the request got", elapsed)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	os.Remove(socket)
+	defer os.Remove(socket)
+	server := http.Server{}
+	server.Handler = &testHandler{t: t}
+	unixListener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go server.Serve(unixListener)
+
+	var exchanges []*Exchange
+	SetRecorder(func(exchange *Exchange) {
+		exchanges = append(exchanges, exchange)
+	})
+	defer SetRecorder(nil)
+
+	client := NewSocketClient(socket)
+	var foo answer
+	err = client.DoJSON(&Request{"POST", pathString, &question{Ping: "junk"}, &foo, nil})
+	verifyFoo(err, foo, t)
+
+	if len(exchanges) != 1 {
+		t.Fatal("expected 1 exchange got", len(exchanges))
+	}
+	exchange := exchanges[0]
+	if exchange.Path != pathString || exchange.Payload != "{\"ping\":\"junk\"}" || exchange.Attempts != 1 ||
+		exchange.StatusCode != http.StatusOK || exchange.Response != "{\"pong\":\"test\"}" || exchange.Error != "" {
+		t.Errorf("unexpected exchange %+v", exchange)
+	}
+}
+
 func TestHTTP(t *testing.T) {
 	// server
 	go http.ListenAndServe(":8080", &testHandler{t: t})
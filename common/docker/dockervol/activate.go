@@ -0,0 +1,97 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dockervol
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/connectivity"
+	"github.com/hpe-storage/dory/common/util"
+	"strings"
+	"sync"
+)
+
+const (
+	//VolumeDriver is the subsystem a volume plugin lists in Implements
+	VolumeDriver = "VolumeDriver"
+)
+
+var (
+	// activations caches the handshake with each plugin address for the life of the process
+	activations     = make(map[string]*ActivateResponse)
+	activationsLock = &sync.Mutex{}
+)
+
+//ActivateResponse lists the subsystems the plugin implements
+type ActivateResponse struct {
+	Implements []string `json:"Implements,omitempty"`
+	Err        string   `json:"Err,omitempty"`
+}
+
+func (a *ActivateResponse) getErr() string {
+	return a.Err
+}
+
+//NotVolumePluginError is returned when the plugin at Address doesn't implement VolumeDriver.  It's
+//usually a misconfigured socket path naming an authorization or network plugin.
+type NotVolumePluginError struct {
+	Address    string
+	Implements []string
+}
+
+func (e *NotVolumePluginError) Error() string {
+	return fmt.Sprintf("%s is not a docker volume plugin, it implements [%s]", e.Address, strings.Join(e.Implements, ", "))
+}
+
+// activate performs the Plugin.Activate handshake the first time the plugin is used and checks
+// that it implements VolumeDriver.  The lock isn't held while the plugin is asked, so a slow plugin
+// doesn't hold up others.  Concurrent first uses may both activate, which docker allows too.
+func (dvp *DockerVolumePlugin) activate() error {
+	activationsLock.Lock()
+	_, found := activations[dvp.socketPath]
+	activationsLock.Unlock()
+	if found {
+		return nil
+	}
+
+	var req = &empty{}
+	var res = &ActivateResponse{}
+	err := dvp.client.DoJSON(&connectivity.Request{
+		Action:        "POST",
+		Path:          ActivateURI,
+		Payload:       req,
+		Response:      res,
+		ResponseError: res})
+	if err != nil {
+		util.LogInfo.Printf("unable to activate %s - %s\n", dvp.socketPath, err.Error())
+		return err
+	}
+	if err = driverErrorCheck(res); err != nil {
+		util.LogInfo.Printf("unable to activate %s - %s\n", dvp.socketPath, err.Error())
+		return err
+	}
+
+	for _, implements := range res.Implements {
+		if implements == VolumeDriver {
+			util.LogDebug.Printf("activated %s implementing %v", dvp.socketPath, res.Implements)
+			activationsLock.Lock()
+			activations[dvp.socketPath] = res
+			activationsLock.Unlock()
+			return nil
+		}
+	}
+	return &NotVolumePluginError{Address: dvp.socketPath, Implements: res.Implements}
+}
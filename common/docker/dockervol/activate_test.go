@@ -0,0 +1,186 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dockervol
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hpe-storage/dory/common/util"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+//activateHandler answers Plugin.Activate with implements and counts the activations.  The first
+//failures activations are answered with an error and activation waits for block if it's set.
+type activateHandler struct {
+	implements  []string
+	failures    int
+	block       chan struct{}
+	activations int
+}
+
+func (h *activateHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == ActivateURI {
+		if h.block != nil {
+			<-h.block
+		}
+		h.activations++
+		if h.activations <= h.failures {
+			json.NewEncoder(w).Encode(&ActivateResponse{Err: "starting"})
+			return
+		}
+		json.NewEncoder(w).Encode(&ActivateResponse{Implements: h.implements})
+		return
+	}
+	json.NewEncoder(w).Encode(&GetResponse{Volume: DockerVolume{Name: "vol1"}})
+}
+
+func TestActivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name       string
+		implements []string
+		volume     bool
+	}{
+		{"volume", []string{"NetworkDriver", VolumeDriver}, true},
+		{"authz", []string{"authz"}, false},
+		{"empty", nil, false},
+	}
+	for _, tc := range tests {
+		socket := filepath.Join(dir, tc.name+".sock")
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := &activateHandler{implements: tc.implements}
+		server := &http.Server{Handler: handler}
+		go server.Serve(listener)
+		defer server.Close()
+
+		// the activation is shared by every client of the socket
+		for i := 0; i < 2; i++ {
+			dvp, err := NewDockerVolumePlugin(&Options{SocketPath: socket})
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = dvp.Get("vol1")
+			if tc.volume && err != nil {
+				t.Errorf("expected %s to be a volume plugin got %s", tc.name, err.Error())
+			}
+			if _, ok := err.(*NotVolumePluginError); !tc.volume && !ok {
+				t.Errorf("expected %s not to be a volume plugin got %v", tc.name, err)
+			}
+		}
+		if tc.volume && handler.activations != 1 {
+			t.Errorf("expected %s to be activated once got %d", tc.name, handler.activations)
+		}
+		// a plugin that isn't a volume plugin isn't remembered
+		if !tc.volume && handler.activations != 2 {
+			t.Errorf("expected %s to be activated twice got %d", tc.name, handler.activations)
+		}
+	}
+}
+
+func TestActivateFailureIsNotCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "plugin.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &activateHandler{implements: []string{VolumeDriver}, failures: 1}
+	server := &http.Server{Handler: handler}
+	go server.Serve(listener)
+	defer server.Close()
+
+	dvp, err := NewDockerVolumePlugin(&Options{SocketPath: socket, RetryPolicy: &util.RetryPolicy{MaxTries: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dvp.Get("vol1"); err == nil {
+		t.Error("expected the first activation to fail")
+	}
+	if _, err = dvp.Get("vol1"); err != nil {
+		t.Error("expected the second activation to succeed got", err)
+	}
+	if handler.activations != 2 {
+		t.Errorf("expected 2 activations got %d", handler.activations)
+	}
+}
+
+func TestActivateDoesNotWaitForOtherPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "activate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var dvps []*DockerVolumePlugin
+	slow := &activateHandler{implements: []string{VolumeDriver}, block: make(chan struct{})}
+	for _, handler := range []*activateHandler{slow, {implements: []string{VolumeDriver}}} {
+		socket := filepath.Join(dir, fmt.Sprintf("plugin%d.sock", len(dvps)))
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &http.Server{Handler: handler}
+		go server.Serve(listener)
+		defer server.Close()
+		dvp, err := NewDockerVolumePlugin(&Options{SocketPath: socket})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dvps = append(dvps, dvp)
+	}
+
+	slowDone := make(chan error)
+	go func() {
+		_, err := dvps[0].Get("vol1")
+		slowDone <- err
+	}()
+	done := make(chan error)
+	go func() {
+		_, err := dvps[1].Get("vol1")
+		done <- err
+	}()
+	select {
+	case err = <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Error("activation waited for another plugin")
+	}
+	close(slow.block)
+	if err = <-slowDone; err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,214 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dockervol
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"github.com/hpe-storage/dory/common/connectivity"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	protocolUnix  = "unix"
+	protocolTCP   = "tcp"
+	protocolHTTPS = "https"
+)
+
+var (
+	// pluginSocketsDir is where docker looks for the sockets of legacy plugins
+	pluginSocketsDir = "/run/docker/plugins"
+	// pluginSpecDirs are where docker looks for the spec and json files of legacy plugins, in order
+	pluginSpecDirs = []string{"/etc/docker/plugins", "/usr/lib/docker/plugins"}
+)
+
+//PluginAddress is where a docker volume plugin listens
+type PluginAddress struct {
+	//Protocol is unix, tcp or https
+	Protocol string
+	//Address is the socket path for unix and host:port for tcp and https
+	Address string
+	//TLSConfig is set if connections use tls, it's always set for https
+	TLSConfig *TLSConfig
+}
+
+//TLSConfig is the tls configuration of a plugin in a json descriptor or the driver config
+type TLSConfig struct {
+	InsecureSkipVerify bool   `json:"InsecureSkipVerify,omitempty"`
+	CAFile             string `json:"CAFile,omitempty"`
+	CertFile           string `json:"CertFile,omitempty"`
+	KeyFile            string `json:"KeyFile,omitempty"`
+}
+
+// pluginDescriptor is the content of a plugin json descriptor
+type pluginDescriptor struct {
+	Name      string     `json:"Name,omitempty"`
+	Addr      string     `json:"Addr,omitempty"`
+	TLSConfig *TLSConfig `json:"TLSConfig,omitempty"`
+}
+
+//String returns the socket path of a unix address and a url for tcp
+func (a *PluginAddress) String() string {
+	if a.Protocol == protocolUnix {
+		return a.Address
+	}
+	return fmt.Sprintf("%s://%s", a.Protocol, a.Address)
+}
+
+//ResolvePlugin finds a legacy plugin by name the way docker does.  It looks for name.sock and
+//name/name.sock in /run/docker/plugins, then for name.spec and name.json in /etc/docker/plugins
+//and /usr/lib/docker/plugins.
+func ResolvePlugin(name string) (*PluginAddress, error) {
+	for _, path := range []string{filepath.Join(pluginSocketsDir, name+".sock"), filepath.Join(pluginSocketsDir, name, name+".sock")} {
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			return &PluginAddress{Protocol: protocolUnix, Address: path}, nil
+		}
+	}
+	for _, dir := range pluginSpecDirs {
+		for _, ext := range []string{".spec", ".json"} {
+			path := filepath.Join(dir, name+ext)
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			return readPluginSpec(path)
+		}
+	}
+	return nil, fmt.Errorf("unable to find plugin named %s in %s or %s", name, pluginSocketsDir, strings.Join(pluginSpecDirs, " or "))
+}
+
+// readPluginSpec reads a spec file holding an address or a json descriptor
+func readPluginSpec(path string) (*PluginAddress, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) == ".json" {
+		descriptor := &pluginDescriptor{}
+		err = json.Unmarshal(data, descriptor)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s - %s", path, err.Error())
+		}
+		return parsePluginAddress(descriptor.Addr, descriptor.TLSConfig)
+	}
+	// a spec file has no tls config, so like docker a tcp plugin is reached over plain http
+	return parsePluginAddress(strings.TrimSpace(string(data)), nil)
+}
+
+// parsePluginAddress parses a unix://, tcp:// or https:// address.  tlsConfig isn't used for unix.
+// https uses the system's root certificates if tlsConfig is nil.
+func parsePluginAddress(addr string, tlsConfig *TLSConfig) (*PluginAddress, error) {
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse plugin address %s - %s", addr, err.Error())
+	}
+	switch u.Scheme {
+	case protocolUnix:
+		if u.Host+u.Path == "" {
+			return nil, fmt.Errorf("plugin address %s has no socket path", addr)
+		}
+		return &PluginAddress{Protocol: protocolUnix, Address: u.Host + u.Path}, nil
+	case protocolTCP:
+		if u.Host == "" {
+			return nil, fmt.Errorf("plugin address %s has no host", addr)
+		}
+		return &PluginAddress{Protocol: protocolTCP, Address: u.Host, TLSConfig: tlsConfig}, nil
+	case protocolHTTPS:
+		if u.Host == "" {
+			return nil, fmt.Errorf("plugin address %s has no host", addr)
+		}
+		if tlsConfig == nil {
+			tlsConfig = &TLSConfig{}
+		}
+		return &PluginAddress{Protocol: protocolHTTPS, Address: u.Host, TLSConfig: tlsConfig}, nil
+	}
+	return nil, fmt.Errorf("unsupported protocol %q in plugin address %s", u.Scheme, addr)
+}
+
+// resolvePluginAddress returns the address of socketPath, which may be a socket path, a unix://,
+// tcp:// or https:// address, the name of a legacy plugin or the name of a V2 plugin.  tlsConfig is
+// only used for tcp:// and https:// addresses, legacy plugins carry their own.
+func resolvePluginAddress(socketPath string, tlsConfig *TLSConfig) (*PluginAddress, error) {
+	if socketPath == "" {
+		socketPath = defaultSocketPath
+	}
+	if strings.HasPrefix(socketPath, "/") {
+		return &PluginAddress{Protocol: protocolUnix, Address: socketPath}, nil
+	}
+	if strings.Contains(socketPath, "://") {
+		return parsePluginAddress(socketPath, tlsConfig)
+	}
+
+	address, err := ResolvePlugin(socketPath)
+	if err == nil {
+		return address, nil
+	}
+	path, v2Err := getV2PluginSocket(socketPath, "")
+	if v2Err != nil {
+		return nil, fmt.Errorf("%s and %s", err.Error(), v2Err.Error())
+	}
+	return &PluginAddress{Protocol: protocolUnix, Address: path}, nil
+}
+
+// newPluginClient returns a client for the plugin at address
+func newPluginClient(address *PluginAddress, timeout time.Duration) (*connectivity.Client, error) {
+	if address.Protocol == protocolUnix {
+		return connectivity.NewSocketClientWithTimeout(address.Address, timeout), nil
+	}
+	if address.TLSConfig == nil {
+		return connectivity.NewHTTPClientWithTimeout("http://"+address.Address, timeout), nil
+	}
+	config, err := address.TLSConfig.build()
+	if err != nil {
+		return nil, err
+	}
+	return connectivity.NewHTTPSClientWithTimeout("https://"+address.Address, &http.Transport{TLSClientConfig: config}, timeout), nil
+}
+
+// build loads the certificates named by c
+func (c *TLSConfig) build() (*tls.Config, error) {
+	config := &tls.Config{InsecureSkipVerify: c.InsecureSkipVerify}
+	if c.CAFile != "" {
+		data, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		config.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		if c.CertFile == "" || c.KeyFile == "" {
+			return nil, fmt.Errorf("a client certificate requires both a certificate file and a key file")
+		}
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
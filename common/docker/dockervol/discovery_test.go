@@ -0,0 +1,175 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dockervol
+
+import (
+	"encoding/pem"
+	"github.com/hpe-storage/dory/common/util"
+	"io/ioutil"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolvePlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "discovery")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedSocketsDir, savedSpecDirs := pluginSocketsDir, pluginSpecDirs
+	defer func() { pluginSocketsDir, pluginSpecDirs = savedSocketsDir, savedSpecDirs }()
+	pluginSocketsDir = filepath.Join(dir, "run")
+	pluginSpecDirs = []string{filepath.Join(dir, "etc"), filepath.Join(dir, "lib")}
+	for _, d := range append(pluginSpecDirs, filepath.Join(pluginSocketsDir, "nested")) {
+		if err = os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, socket := range []string{filepath.Join(pluginSocketsDir, "flat.sock"), filepath.Join(pluginSocketsDir, "nested", "nested.sock")} {
+		listener, err := net.Listen("unix", socket)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer listener.Close()
+	}
+	files := map[string]string{
+		"etc/unix.spec":  "unix:///run/unix.sock\n",
+		"etc/tcp.spec":   "tcp://10.0.0.1:8080",
+		"lib/tls.json":   `{"Name":"tls","Addr":"tcp://plugin.example.com:443","TLSConfig":{"CAFile":"/etc/ca.pem"}}`,
+		"lib/plain.json": `{"Name":"plain","Addr":"tcp://10.0.0.2:8080"}`,
+		"etc/bad.spec":   "http://10.0.0.3",
+		// the first directory wins
+		"etc/both.spec": "unix:///run/etc.sock",
+		"lib/both.spec": "unix:///run/lib.sock",
+	}
+	for name, content := range files {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		tls     bool
+	}{
+		{"flat", filepath.Join(pluginSocketsDir, "flat.sock"), false},
+		{"nested", filepath.Join(pluginSocketsDir, "nested", "nested.sock"), false},
+		{"unix", "/run/unix.sock", false},
+		{"tcp", "tcp://10.0.0.1:8080", false},
+		{"tls", "tcp://plugin.example.com:443", true},
+		{"plain", "tcp://10.0.0.2:8080", false},
+		{"both", "/run/etc.sock", false},
+		{"bad", "", false},
+		{"missing", "", false},
+	}
+	for _, tc := range tests {
+		address, err := ResolvePlugin(tc.name)
+		if tc.address == "" {
+			if err == nil {
+				t.Errorf("expected %s not to resolve got %s", tc.name, address)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("unable to resolve %s - %s", tc.name, err.Error())
+			continue
+		}
+		if address.String() != tc.address || (address.TLSConfig != nil) != tc.tls {
+			t.Errorf("expected %s to resolve to %s (tls=%t) got %s (tls=%t)", tc.name, tc.address, tc.tls, address, address.TLSConfig != nil)
+		}
+	}
+}
+
+func TestResolvePluginAddress(t *testing.T) {
+	tests := []struct {
+		socketPath string
+		address    string
+	}{
+		{"", defaultSocketPath},
+		{"/run/docker/plugins/other.sock", "/run/docker/plugins/other.sock"},
+		{"unix:///run/docker/plugins/other.sock", "/run/docker/plugins/other.sock"},
+		{"tcp://10.0.0.1:8080", "tcp://10.0.0.1:8080"},
+		{"https://plugin.example.com", "https://plugin.example.com"},
+	}
+	for _, tc := range tests {
+		address, err := resolvePluginAddress(tc.socketPath, nil)
+		if err != nil || address.String() != tc.address {
+			t.Errorf("expected %q to resolve to %s got %v %v", tc.socketPath, tc.address, address, err)
+		}
+	}
+
+	// only tcp:// and https:// addresses use tls
+	tlsConfig := &TLSConfig{CAFile: "/etc/dory/ca.pem"}
+	for socketPath, tls := range map[string]bool{"/run/docker/plugins/other.sock": false, "tcp://10.0.0.1:8080": true, "https://plugin.example.com": true} {
+		address, err := resolvePluginAddress(socketPath, tlsConfig)
+		if err != nil || (address.TLSConfig != nil) != tls {
+			t.Errorf("expected %s to use tls=%t got %v %v", socketPath, tls, address, err)
+		}
+	}
+	address, _ := resolvePluginAddress("https://plugin.example.com", nil)
+	if address.TLSConfig == nil {
+		t.Error("expected https to use tls without a tls config")
+	}
+
+	if _, err := resolvePluginAddress("tcp://", nil); err == nil {
+		t.Error("expected an address without a host to fail")
+	}
+}
+
+func TestRemotePlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "remote")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewTLSServer(&activateHandler{implements: []string{VolumeDriver}})
+	defer server.Close()
+	caFile := filepath.Join(dir, "ca.pem")
+	err = ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the server's certificate isn't trusted without the ca
+	dvp, err := NewDockerVolumePlugin(&Options{SocketPath: server.URL, RetryPolicy: &util.RetryPolicy{MaxTries: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = dvp.Get("vol1"); err == nil {
+		t.Error("expected an untrusted server to fail")
+	}
+
+	dvp, err = NewDockerVolumePlugin(&Options{SocketPath: server.URL, TLSConfig: &TLSConfig{CAFile: caFile}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	volume, err := dvp.Get("vol1")
+	if err != nil || volume.Volume.Name != "vol1" {
+		t.Errorf("expected vol1 from %s got %v %v", server.URL, volume, err)
+	}
+
+	_, err = NewDockerVolumePlugin(&Options{SocketPath: server.URL, TLSConfig: &TLSConfig{CertFile: caFile}})
+	if err == nil {
+		t.Error("expected a certificate without a key to fail")
+	}
+}
@@ -22,6 +22,7 @@ import (
 	"github.com/hpe-storage/dory/common/docker/dockerlt"
 	"github.com/hpe-storage/dory/common/util"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -44,14 +45,25 @@ const (
 	UnmountURI = "/VolumeDriver.Unmount"
 	//GetURI is /VolumeDriver.Get
 	GetURI = "/VolumeDriver.Get"
+	//PathURI is /VolumeDriver.Path
+	PathURI = "/VolumeDriver.Path"
 	//NotFound describes the beginning of the not found error message
 	NotFound = "Unable to find"
+	//ScopeLocal means the plugin's volumes only exist on the node they were created on
+	ScopeLocal = "local"
+	//ScopeGlobal means the plugin's volumes are available on every node
+	ScopeGlobal = "global"
 
 	defaultSocketPath = "/run/docker/plugins/nimble.sock"
-	maxTries          = 3
 	dvpSocketTimeout  = time.Duration(300) * time.Second
 )
 
+var (
+	// capabilities caches the capabilities reported by each plugin socket for the life of the process
+	capabilities     = make(map[string]*CapResponse)
+	capabilitiesLock = &sync.Mutex{}
+)
+
 //Options  for volumedriver
 type Options struct {
 	SocketPath                   string
@@ -62,6 +74,10 @@ type Options struct {
 	ListOfStorageResourceOptions []string
 	FactorForConversion          int
 	SupportsCapabilities         bool
+	//RetryPolicy is used by Mount, Unmount and the client, util.DefaultRetryPolicy is used if it's nil
+	RetryPolicy *util.RetryPolicy
+	//TLSConfig is used for tcp:// and https:// socket paths, https:// uses the system's roots if it's nil
+	TLSConfig *TLSConfig
 }
 
 //DockerVolumePlugin is the client to a specific docker volume plugin
@@ -70,6 +86,9 @@ type DockerVolumePlugin struct {
 	client                       *connectivity.Client
 	ListOfStorageResourceOptions []string
 	FactorForConversion          int
+	retryPolicy                  *util.RetryPolicy
+	socketPath                   string
+	supportsCapabilities         bool
 }
 
 //Errorer describes the ability get the embedded error
@@ -137,28 +156,30 @@ type PluginCapabilities struct {
 }
 
 // NewDockerVolumePlugin creates a DockerVolumePlugin which can be used to communicate with
-// a Docker Volume Plugin.  options.socketPath can be the full path to the socket file or
-// the name of a Docker V2 plugin.  In the case of the V2 plugin, the name of th plugin
-// is used to look up the full path to the socketfile.
+// a Docker Volume Plugin.  options.socketPath can be the full path to the socket file, a unix://,
+// tcp:// or https:// address, the name of a legacy plugin found the way docker finds them (see ResolvePlugin)
+// or the name of a Docker V2 plugin.  options.SocketPath is replaced with the resolved address.
 func NewDockerVolumePlugin(options *Options) (*DockerVolumePlugin, error) {
-	var err error
-	if !strings.HasPrefix(options.SocketPath, "/") {
-		// this is a v2 plugin, so we need to find its socket file
-		options.SocketPath, err = getV2PluginSocket(options.SocketPath, "")
+	address, err := resolvePluginAddress(options.SocketPath, options.TLSConfig)
+	if err != nil {
+		return nil, err
 	}
+	options.SocketPath = address.String()
+	client, err := newPluginClient(address, dvpSocketTimeout)
 	if err != nil {
 		return nil, err
 	}
 
-	if options.SocketPath == "" {
-		options.SocketPath = defaultSocketPath
-	}
 	dvp := &DockerVolumePlugin{
-		stripK8sOpts: options.StripK8sFromOptions,
-		client:       connectivity.NewSocketClientWithTimeout(options.SocketPath, dvpSocketTimeout),
+		stripK8sOpts:                 options.StripK8sFromOptions,
+		client:                       client,
 		ListOfStorageResourceOptions: options.ListOfStorageResourceOptions,
 		FactorForConversion:          options.FactorForConversion,
+		retryPolicy:                  options.RetryPolicy,
+		socketPath:                   options.SocketPath,
+		supportsCapabilities:         options.SupportsCapabilities,
 	}
+	dvp.client.SetRetryPolicy(options.RetryPolicy)
 
 	if options.SupportsCapabilities {
 		// test connectivity
@@ -174,8 +195,15 @@ func NewDockerVolumePlugin(options *Options) (*DockerVolumePlugin, error) {
 
 type empty struct{}
 
-//Capabilities returns the capabilities supported by the plugin
+//Capabilities returns the capabilities supported by the plugin.  They are only requested once per socket.
 func (dvp *DockerVolumePlugin) Capabilities() (*CapResponse, error) {
+	capabilitiesLock.Lock()
+	cached, found := capabilities[dvp.socketPath]
+	capabilitiesLock.Unlock()
+	if found {
+		return cached, nil
+	}
+
 	var req = &empty{}
 	var res = &CapResponse{}
 
@@ -190,10 +218,26 @@ func (dvp *DockerVolumePlugin) Capabilities() (*CapResponse, error) {
 		return nil, err
 	}
 
+	capabilitiesLock.Lock()
+	capabilities[dvp.socketPath] = res
+	capabilitiesLock.Unlock()
 	util.LogDebug.Printf("returning %#v", res)
 	return res, nil
 }
 
+//Scope returns the scope reported by the plugin.  ScopeGlobal is assumed if the plugin doesn't
+//support capabilities or they can't be retrieved.
+func (dvp *DockerVolumePlugin) Scope() string {
+	if !dvp.supportsCapabilities {
+		return ScopeGlobal
+	}
+	res, err := dvp.Capabilities()
+	if err != nil || res.Capabilities.Scope == "" {
+		return ScopeGlobal
+	}
+	return res.Capabilities.Scope
+}
+
 //Get a docker volume by docker name returning the response from the driver
 func (dvp *DockerVolumePlugin) Get(name string) (*GetResponse, error) {
 	var req = &Request{Name: name}
@@ -218,6 +262,33 @@ func (dvp *DockerVolumePlugin) Get(name string) (*GetResponse, error) {
 	return res, nil
 }
 
+//Path returns the mountpoint of a docker volume on this host.  An empty path means the volume isn't mounted.
+func (dvp *DockerVolumePlugin) Path(name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	var req = &Request{Name: name}
+	var res = &MountResponse{}
+
+	err := dvp.driverRun(&connectivity.Request{
+		Action:        "POST",
+		Path:          PathURI,
+		Payload:       req,
+		Response:      res,
+		ResponseError: res})
+	if err != nil {
+		util.LogInfo.Printf("unable to get the path of docker volume %s - %s response - %v\n", name, err.Error(), res)
+		return "", err
+	}
+
+	if err = driverErrorCheck(res); err != nil {
+		util.LogInfo.Printf("unable to get the path of docker volume %s - %s\n", name, err.Error())
+		return "", err
+	}
+	util.LogDebug.Printf("returning %#v", res)
+	return res.Mountpoint, nil
+}
+
 //List the docker volumes returning the response from the driver
 func (dvp *DockerVolumePlugin) List() (*GetListResponse, error) {
 	var req = &Request{}
@@ -248,7 +319,8 @@ func (dvp *DockerVolumePlugin) createOrUpdate(name string, options map[string]in
 		return "", fmt.Errorf("name is required")
 	}
 	for key := range options {
-		if key == "name" || (dvp.stripK8sOpts && strings.HasPrefix(key, "kubernetes.io")) {
+		// secrets are always forwarded, the plugin needs them even when the other kubernetes.io options are stripped
+		if key == "name" || (dvp.stripK8sOpts && strings.HasPrefix(key, "kubernetes.io") && !util.IsSecret(key)) {
 			delete(options, key)
 		}
 	}
@@ -271,7 +343,7 @@ func (dvp *DockerVolumePlugin) createOrUpdate(name string, options map[string]in
 			ResponseError: res})
 	}
 	if err != nil {
-		util.LogError.Printf("unable to create/update docker volume using %v & %v - %s response - %v\n", name, options, err.Error(), res)
+		util.LogError.Printf("unable to create/update docker volume using %v & %v - %s response - %v\n", name, util.RedactSecretOptions(options), err.Error(), res)
 		return "", err
 	}
 	if err = driverErrorCheck(res); err != nil {
@@ -285,18 +357,37 @@ func (dvp *DockerVolumePlugin) createOrUpdate(name string, options map[string]in
 func (dvp *DockerVolumePlugin) Update(name string, options map[string]interface{}) (string, error) {
 	name, err := dvp.createOrUpdate(name, options, true)
 	if err != nil {
-		util.LogError.Printf("unable to update docker volume using %v & %v - %s\n", name, options, err.Error())
+		util.LogError.Printf("unable to update docker volume using %v & %v - %s\n", name, util.RedactSecretOptions(options), err.Error())
 		return "", err
 	}
 	return name, nil
 }
 
+//Expand updates the size of a docker volume.  sizeInBytes is converted to the plugin's units using
+//FactorForConversion (rounding up) and passed using the first of ListOfStorageResourceOptions.
+func (dvp *DockerVolumePlugin) Expand(name string, sizeInBytes int64) (string, error) {
+	if dvp.FactorForConversion < 1 {
+		return "", fmt.Errorf("unable to expand %s, factorForConversion is %d", name, dvp.FactorForConversion)
+	}
+	size := sizeInBytes / int64(dvp.FactorForConversion)
+	if sizeInBytes%int64(dvp.FactorForConversion) != 0 {
+		size++
+	}
+	sizeOption := "size"
+	if len(dvp.ListOfStorageResourceOptions) > 0 {
+		sizeOption = dvp.ListOfStorageResourceOptions[0]
+	}
+
+	util.LogInfo.Printf("expanding docker volume %s to %s=%d (%d bytes)", name, sizeOption, size, sizeInBytes)
+	return dvp.Update(name, map[string]interface{}{sizeOption: size})
+}
+
 //Create a docker volume returning the docker volume name
 // nolint Create and Update have same signature. For maintaining backward compatibility we need these two definitions
 func (dvp *DockerVolumePlugin) Create(name string, options map[string]interface{}) (string, error) {
 	name, err := dvp.createOrUpdate(name, options, false)
 	if err != nil {
-		util.LogError.Printf("unable to create docker volume using %v & %v - %s\n", name, options, err.Error())
+		util.LogError.Printf("unable to create docker volume using %v & %v - %s\n", name, util.RedactSecretOptions(options), err.Error())
 		return "", err
 	}
 	return name, nil
@@ -305,39 +396,36 @@ func (dvp *DockerVolumePlugin) Create(name string, options map[string]interface{
 //Mount attaches and mounts a nimble volume returning the path
 func (dvp *DockerVolumePlugin) Mount(name, mountID string) (string, error) {
 	util.LogDebug.Printf("Mount called with %s %s", name, mountID)
-	try := 0
-	for {
-		util.LogDebug.Printf("dvp.mounter() called with %s %s %s try:%d", name, mountID, MountURI, try+1)
-		m, err := dvp.mounter(name, mountID, MountURI)
-		if err != nil {
-			if try < maxTries {
-				try++
-				time.Sleep(time.Duration(try) * time.Second)
-				continue
-			}
-			return "", err
-		}
-		return m, nil
+	var m string
+	err := dvp.retryPolicy.Do(MountURI+" of "+name, func(try int) error {
+		util.LogDebug.Printf("dvp.mounter() called with %s %s %s try:%d", name, mountID, MountURI, try)
+		var err error
+		m, err = dvp.mounter(name, mountID, MountURI)
+		return noRetryIfRetried(err)
+	})
+	if err != nil {
+		return "", err
 	}
+	return m, nil
 }
 
-//Unmount and detaches volume for maxTries
+//Unmount and detaches volume using the retry policy
 func (dvp *DockerVolumePlugin) Unmount(name, mountID string) error {
 	util.LogDebug.Printf("Unmount called with %s %s", name, mountID)
-	try := 0
-	for {
-		util.LogDebug.Printf("dvp.mounter() called with %s %s %s try:%d", name, mountID, UnmountURI, try+1)
+	return dvp.retryPolicy.Do(UnmountURI+" of "+name, func(try int) error {
+		util.LogDebug.Printf("dvp.mounter() called with %s %s %s try:%d", name, mountID, UnmountURI, try)
 		_, err := dvp.mounter(name, mountID, UnmountURI)
-		if err != nil {
-			if try < maxTries {
-				try++
-				time.Sleep(time.Duration(try) * time.Second)
-				continue
-			}
-			return err
-		}
-		return nil
+		return noRetryIfRetried(err)
+	})
+}
+
+// noRetryIfRetried keeps failures to reach the plugin, which the client has already retried, from
+// being retried again
+func noRetryIfRetried(err error) error {
+	if _, ok := err.(*connectivity.ConnectionError); ok {
+		return util.NoRetry(err)
 	}
+	return err
 }
 
 //Delete calls the delete function of the plugin
@@ -400,6 +488,9 @@ func (dvp *DockerVolumePlugin) mounter(name, mountID string, path string) (strin
 }
 
 func (dvp *DockerVolumePlugin) driverRun(r *connectivity.Request) error {
+	if err := dvp.activate(); err != nil {
+		return err
+	}
 	return dvp.client.DoJSON(r)
 }
 
@@ -0,0 +1,397 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hpe-storage/dory/common/linux"
+	"github.com/hpe-storage/dory/common/util"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	//flexvolPluginDir is where kubelet places the global device mount paths for flexvolume drivers
+	flexvolPluginDir = "plugins/kubernetes.io/flexvolume"
+	flexvolMountsDir = "mounts"
+	//nodeStatus is the key a plugin may use in a volume's status to report the node it's mounted on
+	nodeStatus = "node"
+)
+
+// AttachDevice is called by the attach/detach controller.  The plugin attaches the volume when it is
+// mounted, so nothing is done here other than returning the docker volume name as the device.
+// The volume is created (if necessary) by mountdevice on the node that has access to the plugin.
+func AttachDevice(args []string) (string, error) {
+	util.LogDebug.Printf("attach (device) called with %s\n", util.RedactSecrets(fmt.Sprint(args)))
+	req := &AttachRequest{}
+	err := json.Unmarshal([]byte(args[0]), req)
+	if err != nil {
+		return "", err
+	}
+	name := req.getBestName()
+	if name == "" {
+		return "", fmt.Errorf("unable to find a volume name in %s", util.RedactSecrets(args[0]))
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus, Device: name}), nil
+}
+
+// WaitForAttach returns the device reported by attach
+func WaitForAttach(args []string) (string, error) {
+	util.LogDebug.Printf("waitforattach called with %s\n", util.RedactSecrets(fmt.Sprint(args)))
+	if args[0] == "" {
+		return "", fmt.Errorf("device is required for %s", WaitForAttachCommand)
+	}
+	return BuildJSONResponse(&Response{Status: SuccessStatus, Device: args[0]}), nil
+}
+
+// IsAttached reports whether the volume has a global device mount on the node.  The attach/detach
+// controller usually calls this from the controller manager, in which case the plugin is asked.
+func IsAttached(args []string) (string, error) {
+	util.LogDebug.Printf("isattached called with %s\n", util.RedactSecrets(fmt.Sprint(args)))
+	err := ensureArg(IsAttachedCommand, args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	req := &AttachRequest{}
+	err = json.Unmarshal([]byte(args[0]), req)
+	if err != nil {
+		return "", err
+	}
+
+	if !isLocalNode(args[1]) {
+		attached, err := isMountedOnNode(req.getBestName(), args[1])
+		if err != nil {
+			return "", err
+		}
+		return BuildJSONResponse(&Response{Status: SuccessStatus, Attached: attached}), nil
+	}
+
+	mountPoint, err := findDeviceMountPath(req.getBestName())
+	if err != nil {
+		return "", err
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus, Attached: mountPoint != ""}), nil
+}
+
+// Detach is called by the attach/detach controller after unmountdevice.  The plugin detaches
+// the volume when it is unmounted, so this only verifies that the device is no longer mounted.
+func Detach(args []string) (string, error) {
+	util.LogDebug.Printf("detach called with %v\n", args)
+	err := ensureArg(DetachCommand, args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	if !isLocalNode(args[1]) {
+		mounted, err := isMountedOnNode(args[0], args[1])
+		if err != nil {
+			return "", err
+		}
+		if mounted {
+			return "", fmt.Errorf("%s is still mounted on %s", args[0], args[1])
+		}
+		return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+	}
+
+	mountPoint, err := findDeviceMountPath(args[0])
+	if err != nil {
+		return "", err
+	}
+	if mountPoint != "" {
+		return "", fmt.Errorf("%s is still mounted at %s", args[0], mountPoint)
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
+
+// isMountedOnNode asks the plugin whether the volume is mounted on nodeName.  Only a plugin that
+// reports the node in the volume's status can say so, otherwise the volume isn't attached to
+// nodeName, since Detach would never succeed for a volume mounted on another node.  A volume
+// the plugin doesn't know isn't mounted anywhere.
+func isMountedOnNode(dockerVolName, nodeName string) (bool, error) {
+	volume, err := dvp.Get(dockerVolName)
+	if err != nil {
+		if isNotFoundOrNotMounted(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	if volume.Volume.Mountpoint == "" {
+		return false, nil
+	}
+	if node, ok := volume.Volume.Status[nodeStatus].(string); ok && node != "" {
+		util.LogDebug.Printf("%s is mounted on %s", dockerVolName, node)
+		return isSameNode(node, nodeName), nil
+	}
+	util.LogInfo.Printf("%s is mounted at %s, the plugin doesn't report the node so assuming it isn't %s", dockerVolName, volume.Volume.Mountpoint, nodeName)
+	return false, nil
+}
+
+// MountDevice mounts the docker volume at the global device mount path.  This is the only place
+// that the plugin is asked to mount the volume in attach mode.  Pods are bind mounted from here.
+func MountDevice(args []string) (string, error) {
+	util.LogDebug.Printf("mountdevice called with %s\n", util.RedactSecrets(fmt.Sprint(args)))
+	err := ensureArg(MountDeviceCommand, args, 2)
+	if err != nil {
+		return "", err
+	}
+
+	req := &AttachRequest{}
+	jsonRequest, err := findJSON(args, req)
+	if err != nil {
+		return "", err
+	}
+
+	err = checkVolumeMode(req)
+	if err != nil {
+		return "", err
+	}
+
+	dockerVolName := req.getBestName()
+	if dockerVolName == "" {
+		dockerVolName = args[1]
+	}
+
+	lock, err := lockVolume(dockerVolName)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
+	mounted, err := isMountedFrom(args[0], dockerVolName)
+	if err != nil {
+		return "", err
+	}
+	if mounted {
+		util.LogInfo.Printf("%s is already mounted at %s", dockerVolName, args[0])
+		return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+	}
+
+	_, err = getOrCreate(dockerVolName, jsonRequest)
+	if err != nil {
+		return "", err
+	}
+
+	mountID, err := getNodeMountID()
+	if err != nil {
+		return "", err
+	}
+
+	path, err := dvp.Mount(dockerVolName, mountID)
+	if err != nil {
+		return "", ClassifyError(ErrorCodeMountFailed, err)
+	}
+
+	err = os.MkdirAll(args[0], 0755)
+	if err != nil {
+		return "", err
+	}
+
+	devPath, err := doMount(args[0], path, dockerVolName, req)
+	if err != nil {
+		return "", ClassifyError(ErrorCodeMountFailed, err)
+	}
+	recordVolumeMount(args[0], path, dockerVolName, devPath, mountID)
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
+
+// UnmountDevice unmounts the global device mount path and asks the plugin to unmount the volume.
+func UnmountDevice(args []string) (string, error) {
+	util.LogDebug.Printf("unmountdevice called with %v\n", args)
+	deviceMountPath := args[0]
+	dockerVolName := filepath.Base(deviceMountPath)
+
+	lock, err := lockVolume(dockerVolName)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
+	mountID, err := getNodeMountID()
+	if err != nil {
+		return "", err
+	}
+
+	err = linux.BindUnmount(deviceMountPath)
+	if err != nil && !strings.Contains(err.Error(), notMounted) {
+		return "", err
+	}
+
+	util.LogDebug.Printf("docker unmount of %s %s", dockerVolName, mountID)
+	err = dvp.Unmount(dockerVolName, mountID)
+	if err != nil && !strings.Contains(err.Error(), notMounted) {
+		return "", err
+	}
+
+	err = forgetMount(deviceMountPath)
+	if err != nil {
+		util.LogError.Printf("UnmountDevice: unable to remove %s from the mount journal - %s", deviceMountPath, err.Error())
+	}
+
+	// clean up the breadcrumb left by earlier versions when the device was mounted directly
+	metadata, err := getMountMetadataPath(deviceMountPath)
+	if err == nil {
+		if is, _, _ := util.FileExists(metadata); is {
+			util.LogDebug.Printf("UnmountDevice: removing metadata=%s", metadata)
+			os.Remove(metadata)
+		}
+	}
+
+	err = deleteIfEphemeral(dockerVolName)
+	if err != nil {
+		return "", err
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
+
+// mountFromDevicePath bind mounts the global device mount path to the pod's path
+func mountFromDevicePath(podPath, dockerVolName string, req *AttachRequest) (string, error) {
+	deviceMountPath, err := getDeviceMountPath(podPath, dockerVolName)
+	if err != nil {
+		return "", err
+	}
+
+	devPath, err := linux.GetDeviceFromMountPoint(deviceMountPath)
+	if err != nil {
+		return "", err
+	}
+	if devPath == "" {
+		return "", newError(ErrorCodeMountFailed, "%s is not mounted at %s, mountdevice must succeed before mount", dockerVolName, deviceMountPath)
+	}
+
+	mount, err := linux.GetMount(podPath)
+	if err != nil {
+		return "", err
+	}
+	if mount != nil {
+		if mount.Device.Pathname != devPath {
+			return "", newError(ErrorCodeAlreadyMounted, "%s is already mounted from %s, not %s", podPath, mount.Device.Pathname, deviceMountPath)
+		}
+		util.LogInfo.Printf("%s is already mounted at %s", deviceMountPath, podPath)
+		return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+	}
+
+	err = os.MkdirAll(podPath, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	err = linux.BindMount(deviceMountPath, podPath, false, req.getMountOptions())
+	if err != nil {
+		return "", ClassifyError(ErrorCodeMountFailed, err)
+	}
+	util.LogDebug.Printf("mountFromDevicePath: bind mounted deviceMountPath=%s at podPath=%s", deviceMountPath, podPath)
+
+	if req.isReadOnly() {
+		err = remountReadOnly(podPath, true)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = applyFsGroup(podPath, req)
+	if err != nil {
+		unmountAfterFailure(podPath, err)
+		return "", err
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
+
+// unmountFromDevicePath removes the pod's bind mount.  The plugin is left alone until unmountdevice.
+func unmountFromDevicePath(podPath string) (string, error) {
+	err := linux.BindUnmount(podPath)
+	if err != nil && !strings.Contains(err.Error(), notMounted) {
+		return "", err
+	}
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
+
+// getDeviceMountPath builds the global device mount path kubelet uses for the volume from the pod's path
+func getDeviceMountPath(podPath, dockerVolName string) (string, error) {
+	path, err := parsePodVolumePath(podPath)
+	if err != nil {
+		return "", err
+	}
+	return path.getDeviceMountPath(dockerVolName), nil
+}
+
+// findDeviceMountPath returns the global device mount path for the volume if it's mounted on this node
+func findDeviceMountPath(dockerVolName string) (string, error) {
+	driver, err := getDriverName()
+	if err != nil {
+		return "", err
+	}
+	suffix := "/" + filepath.Join(flexvolPluginDir, driver, flexvolMountsDir, dockerVolName)
+
+	mounts, err := linux.GetMounts()
+	if err != nil {
+		return "", err
+	}
+	for _, mount := range mounts {
+		if strings.HasSuffix(mount.Mountpoint, suffix) {
+			util.LogDebug.Printf("%s is mounted at %s", dockerVolName, mount.Mountpoint)
+			return mount.Mountpoint, nil
+		}
+	}
+	return "", nil
+}
+
+// getDriverName returns vendor/driver from the directory the driver was installed in
+func getDriverName() (string, error) {
+	dir := filepath.Base(filepath.Dir(execPath))
+	if !strings.Contains(dir, "~") {
+		return "", fmt.Errorf("unable to get the driver name from %s", execPath)
+	}
+	return strings.Replace(dir, "~", "/", 1), nil
+}
+
+// getNodeMountID returns the mount id used with the plugin for the global device mount
+func getNodeMountID() (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("k8s-node-%s", hostname), nil
+}
+
+// getHostname is replaced by the tests
+var getHostname = os.Hostname
+
+func isLocalNode(nodeName string) bool {
+	hostname, err := getHostname()
+	if err != nil {
+		util.LogError.Printf("unable to get hostname - %s", err.Error())
+		return false
+	}
+	return isSameNode(hostname, nodeName)
+}
+
+func isSameNode(node1, node2 string) bool {
+	if strings.EqualFold(node1, node2) {
+		return true
+	}
+	// node names may or may not be fully qualified
+	return strings.EqualFold(strings.Split(node1, ".")[0], strings.Split(node2, ".")[0])
+}
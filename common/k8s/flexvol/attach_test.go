@@ -0,0 +1,148 @@
+package flexvol
+
+import (
+	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"github.com/hpe-storage/dory/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var deviceMountPathTests = []struct {
+	podPath  string
+	name     string
+	expected string
+	err      bool
+}{
+	{"/var/lib/kubelet/pods/fb36bec9-51f7-11e7-8eb8-005056968cbc/volumes/hpe~nimble/test", "vol1", "/var/lib/kubelet/plugins/kubernetes.io/flexvolume/hpe/nimble/mounts/vol1", false},
+	{"/var/lib/origin/openshift.local.volumes/pods/88917cdb-514d-11e7-93fb-5254005e615a/volumes/dev.hpe.com~nimble/test2", "test2", "/var/lib/origin/openshift.local.volumes/plugins/kubernetes.io/flexvolume/dev.hpe.com/nimble/mounts/test2", false},
+	{"/mnt/test", "test", "", true},
+}
+
+func TestGetDeviceMountPath(t *testing.T) {
+	for _, tc := range deviceMountPathTests {
+		t.Run(tc.podPath, func(t *testing.T) {
+			path, err := getDeviceMountPath(tc.podPath, tc.name)
+			if (err != nil) != tc.err {
+				t.Error(
+					"For", "err",
+					"expected", tc.err,
+					"got", err,
+				)
+			}
+			if path != tc.expected {
+				t.Error(
+					"For", "path",
+					"expected", tc.expected,
+					"got", path,
+				)
+			}
+		})
+	}
+}
+
+func TestInitCapabilitiesWithAttach(t *testing.T) {
+	attachEnabled = true
+	defer func() { attachEnabled = false }()
+
+	expectedInitResponse := "{\"status\":\"Success\",\"capabilities\":{\"attach\":true,\"fsGroup\":false,\"getVolumeName\":true,\"requiresFSResize\":true}}"
+	result := Handle("init", false, []string{})
+	if result != expectedInitResponse {
+		t.Errorf("init response mismatch. Expected " + expectedInitResponse + " got " + result)
+	}
+
+	expectedResponse := "{\"status\":\"Success\",\"device\":\"vol1\"}"
+	result = Handle("attach", false, []string{"{\"kubernetes.io/pvOrVolumeName\":\"vol1\"}", "node1"})
+	if result != expectedResponse {
+		t.Errorf("attach response mismatch. Expected " + expectedResponse + " got " + result)
+	}
+
+	// secrets in a request without a name aren't echoed in the error
+	if _, err := AttachDevice([]string{"{\"kubernetes.io/secret/token\":\"c2VjcmV0\"}", "node1"}); err == nil || strings.Contains(err.Error(), "c2VjcmV0") {
+		t.Error("expected an error without the secret got", err)
+	}
+
+	result = Handle("waitforattach", false, []string{"vol1", "{}"})
+	if result != expectedResponse {
+		t.Errorf("waitforattach response mismatch. Expected " + expectedResponse + " got " + result)
+	}
+
+	if RequiresPlugin(AttachCommand) {
+		t.Error("attach should not require the plugin in attach mode")
+	}
+}
+
+func TestIsAttachedOnAnotherNode(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	plugin := &testPlugin{volumes: map[string]*dockervol.DockerVolume{
+		"vol1": {Name: "vol1", Mountpoint: "/var/lib/plugin/vol1", Status: map[string]interface{}{nodeStatus: "node1.example.com"}},
+		"vol2": {Name: "vol2"},
+		"vol3": {Name: "vol3", Mountpoint: "/var/lib/plugin/vol3"},
+	}}
+	defer startTestPlugin(t, dir, plugin)()
+	attachEnabled = true
+	defer func() { attachEnabled = false }()
+	savedGetHostname := getHostname
+	defer func() { getHostname = savedGetHostname }()
+	getHostname = func() (string, error) { return "controller", nil }
+
+	isAttachedTests := []struct {
+		name     string
+		node     string
+		expected string
+	}{
+		{"vol1", "node1", "{\"status\":\"Success\",\"attached\":true}"},
+		{"vol1", "node2", "{\"status\":\"Success\"}"},
+		{"vol2", "node1", "{\"status\":\"Success\"}"},
+		{"vol3", "node1", "{\"status\":\"Success\"}"},
+		{"vol4", "node1", "{\"status\":\"Success\"}"},
+	}
+	for _, tc := range isAttachedTests {
+		result := Handle(IsAttachedCommand, false, []string{"{\"kubernetes.io/pvOrVolumeName\":\"" + tc.name + "\"}", tc.node})
+		if result != tc.expected {
+			t.Errorf("isattached %s on %s expected %s got %s", tc.name, tc.node, tc.expected, result)
+		}
+	}
+
+	// the volume is still mounted on node1
+	if _, err := Detach([]string{"vol1", "node1"}); err == nil {
+		t.Error("expected detach of vol1 from node1 to fail")
+	}
+	if _, err := Detach([]string{"vol1", "node2"}); err != nil {
+		t.Error("unexpected error detaching vol1 from node2", err)
+	}
+	// without the node in its status the volume could be mounted anywhere, so detach doesn't block on it
+	if _, err := Detach([]string{"vol3", "node1"}); err != nil {
+		t.Error("unexpected error detaching vol3 from node1", err)
+	}
+}
+
+func TestIsAttachedWithoutPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "attach")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stop := startTestPlugin(t, dir, &testPlugin{})
+	stop()
+	savedDvp := dvp
+	defer func() { dvp = savedDvp }()
+	dvp, err = dockervol.NewDockerVolumePlugin(&dockervol.Options{SocketPath: filepath.Join(dir, "plugin.sock"), RetryPolicy: &util.RetryPolicy{MaxTries: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an unreachable plugin isn't taken to mean the volume is attached or detached
+	if _, err := IsAttached([]string{"{\"kubernetes.io/pvOrVolumeName\":\"vol1\"}", "node1"}); err == nil {
+		t.Error("expected isattached to fail without the plugin")
+	}
+	if _, err := Detach([]string{"vol1", "node1"}); err == nil {
+		t.Error("expected detach to fail without the plugin")
+	}
+}
@@ -0,0 +1,36 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import "strings"
+
+//VolumeModeBlock asks for the volume's raw device, which FlexVolume can't publish
+const VolumeModeBlock = "Block"
+
+func (ar *AttachRequest) isBlock() bool {
+	return strings.EqualFold(ar.VolumeMode, VolumeModeBlock)
+}
+
+// checkVolumeMode returns an error for block volumes.  FlexVolume isn't a block volume plugin, so
+// kubelet can only treat the volume as a filesystem.  Publishing the device node at the pod path
+// instead would only work for privileged pods, the device cgroup denies everyone else.
+func checkVolumeMode(req *AttachRequest) error {
+	if req.isBlock() {
+		return newError(ErrorCodeMountFailed, "%s is a block volume, flexvolume drivers can't publish block volumes", req.getBestName())
+	}
+	return nil
+}
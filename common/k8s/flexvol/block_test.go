@@ -0,0 +1,31 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import "testing"
+
+func TestCheckVolumeMode(t *testing.T) {
+	if err := checkVolumeMode(&AttachRequest{Name: "vol1"}); err != nil {
+		t.Error("expected a filesystem volume to be allowed got", err)
+	}
+	if err := checkVolumeMode(&AttachRequest{Name: "vol1", VolumeMode: "Filesystem"}); err != nil {
+		t.Error("expected a filesystem volume to be allowed got", err)
+	}
+	if err := checkVolumeMode(&AttachRequest{Name: "vol1", VolumeMode: "block"}); GetErrorCode(err) != ErrorCodeMountFailed {
+		t.Error("expected a block volume to fail got", err)
+	}
+}
@@ -0,0 +1,210 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/linux"
+	"github.com/hpe-storage/dory/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	//DiagnosisOK indicates the check passed
+	DiagnosisOK = "ok"
+	//DiagnosisWarning indicates the check found something that may cause problems
+	DiagnosisWarning = "warning"
+	//DiagnosisFailed indicates the check failed
+	DiagnosisFailed = "failed"
+)
+
+//Diagnosis is the result of a single node check
+type Diagnosis struct {
+	Check   string   `json:"check"`
+	Status  string   `json:"status"`
+	Message string   `json:"message,omitempty"`
+	Details []string `json:"details,omitempty"`
+}
+
+//Diagnose checks the path from kubelet to the docker volume plugin on this node.  Config must be
+//called first, its error (if any) should be passed as configErr.
+func Diagnose(configErr error) []*Diagnosis {
+	diagnoses := []*Diagnosis{diagnoseSocket(configErr)}
+	if dvp == nil {
+		return diagnoses
+	}
+
+	caps, err := dvp.Capabilities()
+	if err != nil {
+		diagnoses = append(diagnoses, &Diagnosis{Check: "capabilities", Status: DiagnosisFailed, Message: err.Error()})
+	} else {
+		diagnoses = append(diagnoses, &Diagnosis{Check: "capabilities", Status: DiagnosisOK, Message: fmt.Sprintf("scope=%s", caps.Capabilities.Scope)})
+	}
+
+	list, err := dvp.List()
+	if err != nil {
+		diagnoses = append(diagnoses, &Diagnosis{Check: "list", Status: DiagnosisFailed, Message: err.Error()})
+		return append(diagnoses, diagnosePropagation())
+	}
+	volumes := make(map[string]bool)
+	for _, vol := range list.Volumes {
+		volumes[vol.Name] = true
+	}
+	diagnoses = append(diagnoses, &Diagnosis{Check: "list", Status: DiagnosisOK, Message: fmt.Sprintf("%d volumes", len(volumes))})
+
+	diagnoses = append(diagnoses, diagnosePropagation())
+
+	problems := crossCheckMounts(volumes)
+	mounts := &Diagnosis{Check: "mounts", Status: DiagnosisOK, Details: problems}
+	if len(problems) > 0 {
+		mounts.Status = DiagnosisWarning
+		mounts.Message = "mounts, journal entries or breadcrumbs don't match the plugin"
+	}
+	return append(diagnoses, mounts)
+}
+
+func diagnoseSocket(configErr error) *Diagnosis {
+	diagnosis := &Diagnosis{Check: "socket", Status: DiagnosisOK, Message: socketPath}
+	if dvp == nil {
+		diagnosis.Status = DiagnosisFailed
+		diagnosis.Message = fmt.Sprintf("unable to resolve %s - %v", socketPath, configErr)
+		return diagnosis
+	}
+	// tcp plugins are checked by asking for their capabilities and volumes
+	if !strings.HasPrefix(socketPath, "/") {
+		return diagnosis
+	}
+	info, err := os.Stat(socketPath)
+	if err != nil {
+		diagnosis.Status = DiagnosisFailed
+		diagnosis.Message = err.Error()
+	} else if info.Mode()&os.ModeSocket == 0 {
+		diagnosis.Status = DiagnosisFailed
+		diagnosis.Message = fmt.Sprintf("%s is not a socket", socketPath)
+	}
+	return diagnosis
+}
+
+// diagnosePropagation checks that mounts made under the kubelet root reach kubelet.  This matters
+// when dory runs in a different mount namespace than kubelet.
+func diagnosePropagation() *Diagnosis {
+	diagnosis := &Diagnosis{Check: "propagation", Status: DiagnosisOK}
+	found := false
+	for _, root := range kubeletRootDirs {
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		found = true
+		propagation, mountPoint, err := linux.GetMountPropagation(root)
+		if err != nil {
+			diagnosis.Status = DiagnosisWarning
+			diagnosis.Details = append(diagnosis.Details, fmt.Sprintf("%s - %s", root, err.Error()))
+			continue
+		}
+		diagnosis.Details = append(diagnosis.Details, fmt.Sprintf("%s is on %s mount %s", root, propagation, mountPoint))
+		if propagation != linux.PropagationShared {
+			diagnosis.Status = DiagnosisWarning
+		}
+	}
+	if !found {
+		diagnosis.Status = DiagnosisWarning
+		diagnosis.Message = fmt.Sprintf("none of the kubelet root directories %v exist", kubeletRootDirs)
+	}
+	return diagnosis
+}
+
+// crossCheckMounts compares the pod mounts for this driver, the mount journal and any breadcrumbs
+// with the volumes the plugin knows about.
+func crossCheckMounts(volumes map[string]bool) []string {
+	var problems []string
+	driver := filepath.Base(filepath.Dir(execPath))
+
+	mounts, err := linux.GetMounts()
+	if err != nil {
+		return append(problems, fmt.Sprintf("unable to read mounts - %s", err.Error()))
+	}
+	mountedVolumes := make(map[string]bool)
+	for _, mount := range mounts {
+		podPath, err := parsePodVolumePath(mount.Mountpoint)
+		if err != nil || podPath.Driver != driver {
+			continue
+		}
+		mountedVolumes[podPath.VolumeName] = true
+		name := podPath.VolumeName
+		entry, _ := lookupMount(mount.Mountpoint)
+		if entry != nil {
+			name = entry.DockerVolume
+		} else if !hasMountMetadata(mount.Mountpoint) {
+			problems = append(problems, fmt.Sprintf("%s is mounted but has no journal entry", mount.Mountpoint))
+		}
+		if !volumes[name] {
+			problems = append(problems, fmt.Sprintf("%s is mounted at %s but the plugin doesn't list it", name, mount.Mountpoint))
+		}
+	}
+
+	var journal *mountJournal
+	err = updateJournal(func(j *mountJournal) bool {
+		journal = j
+		return false
+	})
+	if err != nil {
+		problems = append(problems, fmt.Sprintf("unable to read the mount journal - %s", err.Error()))
+	} else {
+		for path, entry := range journal.Entries {
+			if mount, _ := linux.GetMount(path); mount == nil {
+				problems = append(problems, fmt.Sprintf("journal entry for %s but it isn't mounted", path))
+			}
+			if !volumes[entry.DockerVolume] {
+				problems = append(problems, fmt.Sprintf("journal entry for %s references %s which the plugin doesn't list", path, entry.DockerVolume))
+			}
+		}
+	}
+
+	for name, dockerPath := range getBreadcrumbs() {
+		if !mountedVolumes[name] {
+			problems = append(problems, fmt.Sprintf("breadcrumb for %s (%s) doesn't match a mounted volume", name, dockerPath))
+		}
+	}
+	return problems
+}
+
+// getBreadcrumbs returns the breadcrumbs left by earlier versions keyed by k8s volume name
+func getBreadcrumbs() map[string]string {
+	breadcrumbs := make(map[string]string)
+	dir := filepath.Dir(execPath)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		util.LogError.Printf("unable to read %s - %s", dir, err.Error())
+		return breadcrumbs
+	}
+	for _, file := range files {
+		name := file.Name()
+		if file.IsDir() || !strings.HasPrefix(name, ".") || strings.HasPrefix(name, journalFile) || name == journalLockFile ||
+			strings.HasPrefix(name, "."+filepath.Base(execPath)+".") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		breadcrumbs[strings.TrimPrefix(name, ".")] = string(data)
+	}
+	return breadcrumbs
+}
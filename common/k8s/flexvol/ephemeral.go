@@ -0,0 +1,123 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/util"
+	"strconv"
+	"time"
+)
+
+const (
+	//ephemeralOption asks the driver to delete the volume it creates when the last pod using it goes away.
+	//It's removed before the volume is created.
+	ephemeralOption = "ephemeral"
+)
+
+//CreatedVolume records a docker volume the driver created for an ephemeral inline volume
+type CreatedVolume struct {
+	DockerVolume string    `json:"dockerVolume"`
+	Socket       string    `json:"socket,omitempty"`
+	Created      time.Time `json:"created"`
+}
+
+// isEphemeral returns true if the ephemeral option in the create options is true
+func isEphemeral(options map[string]interface{}) bool {
+	value, found := options[ephemeralOption]
+	if !found {
+		return false
+	}
+	ephemeral, err := strconv.ParseBool(fmt.Sprint(value))
+	if err != nil {
+		util.LogError.Printf("ignoring %s=%v - %s", ephemeralOption, value, err.Error())
+		return false
+	}
+	return ephemeral
+}
+
+// recordCreated records that the driver created the docker volume, so it's deleted on the final unmount
+func recordCreated(dockerVolName string) error {
+	util.LogDebug.Printf("recordCreated called with %s", dockerVolName)
+	return updateJournal(func(journal *mountJournal) bool {
+		journal.Created[dockerVolName] = &CreatedVolume{DockerVolume: dockerVolName, Socket: socketPath, Created: time.Now()}
+		return true
+	})
+}
+
+// deleteIfEphemeral deletes the docker volume if the driver created it for an ephemeral volume and
+// nothing on the node is still using it.  The journal only knows about this node, so the volume is
+// kept while the plugin reports it mounted, for example on another node.  Volumes the driver didn't
+// create are never deleted.  The caller holds the volume lock.
+func deleteIfEphemeral(dockerVolName string) error {
+	var created *CreatedVolume
+	err := updateJournal(func(journal *mountJournal) bool {
+		created = journal.Created[dockerVolName]
+		if created == nil {
+			return false
+		}
+		for _, entry := range journal.Entries {
+			if entry.DockerVolume == dockerVolName {
+				util.LogDebug.Printf("ephemeral volume %s is still mounted at %s", dockerVolName, entry.K8sPath)
+				created = nil
+				return false
+			}
+		}
+		return false
+	})
+	if err != nil || created == nil {
+		return err
+	}
+	if created.Socket != "" && created.Socket != socketPath {
+		util.LogInfo.Printf("ephemeral volume %s was created using %s, not deleting it using %s", dockerVolName, created.Socket, socketPath)
+		return nil
+	}
+
+	volume, err := dvp.Get(dockerVolName)
+	if err != nil {
+		if isNotFoundOrNotMounted(err) {
+			util.LogInfo.Printf("ephemeral volume %s no longer exists", dockerVolName)
+			return forgetCreated(dockerVolName)
+		}
+		return err
+	}
+	if volume.Volume.Mountpoint != "" {
+		util.LogInfo.Printf("ephemeral volume %s is still mounted at %s, not deleting it", dockerVolName, volume.Volume.Mountpoint)
+		return nil
+	}
+	if node, ok := volume.Volume.Status[nodeStatus].(string); ok && node != "" {
+		util.LogInfo.Printf("ephemeral volume %s is still mounted on %s, not deleting it", dockerVolName, node)
+		return nil
+	}
+
+	util.LogInfo.Printf("deleting ephemeral volume %s created %s", dockerVolName, created.Created.Format(time.RFC3339))
+	err = dvp.Delete(dockerVolName, "")
+	if err != nil {
+		// ownership is kept so the delete is retried when kubelet retries the unmount
+		return err
+	}
+
+	return forgetCreated(dockerVolName)
+}
+
+// forgetCreated removes the record that the driver created the docker volume
+func forgetCreated(dockerVolName string) error {
+	return updateJournal(func(journal *mountJournal) bool {
+		delete(journal.Created, dockerVolName)
+		return true
+	})
+}
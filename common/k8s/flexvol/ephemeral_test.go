@@ -0,0 +1,108 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsEphemeral(t *testing.T) {
+	tests := []struct {
+		options   map[string]interface{}
+		ephemeral bool
+	}{
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"ephemeral": "true"}, true},
+		{map[string]interface{}{"ephemeral": true}, true},
+		{map[string]interface{}{"ephemeral": "False"}, false},
+		{map[string]interface{}{"ephemeral": "sometimes"}, false},
+	}
+	for _, tc := range tests {
+		if isEphemeral(tc.options) != tc.ephemeral {
+			t.Errorf("For %v expected %t", tc.options, tc.ephemeral)
+		}
+	}
+}
+
+func TestDeleteIfEphemeral(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ephemeral")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedExecPath := execPath
+	defer func() { execPath = savedExecPath }()
+	execPath = filepath.Join(dir, "nimble")
+
+	handler := &testPlugin{}
+	defer startTestPlugin(t, dir, handler)()
+
+	// volumes the driver didn't create are never deleted
+	if err = deleteIfEphemeral("vol2"); err != nil || len(handler.removed) != 0 {
+		t.Fatalf("expected vol2 to be left alone got %v %v", handler.removed, err)
+	}
+
+	pod1 := "/var/lib/kubelet/pods/uid1/volumes/hpe~nimble/vol1"
+	if err = recordCreated("vol1"); err != nil {
+		t.Fatal(err)
+	}
+	if err = recordMount(&MountEntry{K8sPath: pod1, DockerVolume: "vol1", MountID: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = deleteIfEphemeral("vol1"); err != nil || len(handler.removed) != 0 {
+		t.Fatalf("expected vol1 to be kept while it's mounted got %v %v", handler.removed, err)
+	}
+
+	if err = forgetMount(pod1); err != nil {
+		t.Fatal(err)
+	}
+	// the plugin still reports the volume mounted, for example on another node
+	handler.volumes = map[string]*dockervol.DockerVolume{"vol1": {Name: "vol1", Mountpoint: "/var/lib/plugin/vol1"}}
+	if err = deleteIfEphemeral("vol1"); err != nil || len(handler.removed) != 0 {
+		t.Fatalf("expected vol1 to be kept while the plugin reports it mounted got %v %v", handler.removed, err)
+	}
+	handler.volumes["vol1"] = &dockervol.DockerVolume{Name: "vol1", Status: map[string]interface{}{nodeStatus: "node2"}}
+	if err = deleteIfEphemeral("vol1"); err != nil || len(handler.removed) != 0 {
+		t.Fatalf("expected vol1 to be kept while the plugin reports it on node2 got %v %v", handler.removed, err)
+	}
+
+	handler.volumes["vol1"] = &dockervol.DockerVolume{Name: "vol1"}
+	if err = deleteIfEphemeral("vol1"); err != nil || len(handler.removed) != 1 || handler.removed[0] != "vol1" {
+		t.Fatalf("expected vol1 to be deleted got %v %v", handler.removed, err)
+	}
+
+	// ownership is forgotten once the volume is deleted
+	if err = deleteIfEphemeral("vol1"); err != nil || len(handler.removed) != 1 {
+		t.Errorf("expected vol1 to be deleted once got %v %v", handler.removed, err)
+	}
+
+	// a volume that's already gone is forgotten without a delete
+	if err = recordCreated("vol3"); err != nil {
+		t.Fatal(err)
+	}
+	if err = deleteIfEphemeral("vol3"); err != nil || len(handler.removed) != 1 {
+		t.Errorf("expected vol3 not to be deleted got %v %v", handler.removed, err)
+	}
+	journal, err := loadJournal()
+	if err != nil || journal.Created["vol3"] != nil {
+		t.Errorf("expected vol3 to be forgotten got %v %v", journal, err)
+	}
+}
@@ -0,0 +1,92 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/connectivity"
+	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"github.com/hpe-storage/dory/common/linux"
+)
+
+const (
+	//ErrorCodePluginUnreachable means the docker volume plugin couldn't be found or didn't answer
+	ErrorCodePluginUnreachable = "plugin-unreachable"
+	//ErrorCodeNotVolumePlugin means the socket belongs to a docker plugin that isn't a volume plugin
+	ErrorCodeNotVolumePlugin = "not-volume-plugin"
+	//ErrorCodeVolumeNotFound means the docker volume plugin doesn't know the volume
+	ErrorCodeVolumeNotFound = "volume-not-found"
+	//ErrorCodeCreateDisabled means the volume doesn't exist and the driver is configured not to create volumes
+	ErrorCodeCreateDisabled = "create-disabled"
+	//ErrorCodeWrongNode means the volume is local to another node
+	ErrorCodeWrongNode = "wrong-node"
+	//ErrorCodeAlreadyMounted means the path is already mounted from something else
+	ErrorCodeAlreadyMounted = "already-mounted"
+	//ErrorCodeMountFailed means the docker volume plugin or the node failed to mount the volume
+	ErrorCodeMountFailed = "mount-failed"
+	//ErrorCodeTimeout means the plugin or another dory process didn't respond in time
+	ErrorCodeTimeout = "timeout"
+	//ErrorCodeUnknown is used for failures that haven't been classified
+	ErrorCodeUnknown = "unknown"
+)
+
+//Error is a failure with a code that automation can rely on.  The message is meant for people and may change.
+type Error struct {
+	Code string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// newError returns an error with the code and a formatted message
+func newError(code, format string, a ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, a...)}
+}
+
+//ClassifyError returns err with the code unless a more specific code is already known for err.
+//Errors from the plugin connection and lock timeouts keep their own code.
+func ClassifyError(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if GetErrorCode(err) != ErrorCodeUnknown {
+		return err
+	}
+	return &Error{Code: code, Err: err}
+}
+
+//GetErrorCode returns the code of err, ErrorCodeUnknown if it hasn't been classified
+func GetErrorCode(err error) string {
+	switch e := err.(type) {
+	case nil:
+		return ""
+	case *Error:
+		return e.Code
+	case *connectivity.ConnectionError:
+		if e.Timeout() {
+			return ErrorCodeTimeout
+		}
+		return ErrorCodePluginUnreachable
+	case *dockervol.NotVolumePluginError:
+		return ErrorCodeNotVolumePlugin
+	case *linux.MountedError:
+		return ErrorCodeAlreadyMounted
+	}
+	return ErrorCodeUnknown
+}
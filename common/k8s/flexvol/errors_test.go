@@ -0,0 +1,68 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"errors"
+	"github.com/hpe-storage/dory/common/connectivity"
+	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"github.com/hpe-storage/dory/common/linux"
+	"testing"
+)
+
+type timeoutError struct{}
+
+func (e *timeoutError) Error() string { return "i/o timeout" }
+func (e *timeoutError) Timeout() bool { return true }
+
+func TestGetErrorCode(t *testing.T) {
+	plain := errors.New("plain")
+	tests := []struct {
+		err  error
+		code string
+	}{
+		{nil, ""},
+		{plain, ErrorCodeUnknown},
+		{newError(ErrorCodeCreateDisabled, "configured to NOT create volumes"), ErrorCodeCreateDisabled},
+		{&connectivity.ConnectionError{Err: plain}, ErrorCodePluginUnreachable},
+		{&connectivity.ConnectionError{Err: &timeoutError{}}, ErrorCodeTimeout},
+		{&linux.MountedError{Device: "/dev/sdb", MountPoint: "/mnt"}, ErrorCodeAlreadyMounted},
+		{ClassifyError(ErrorCodeVolumeNotFound, &dockervol.NotVolumePluginError{Address: "/run/docker/plugins/authz.sock"}), ErrorCodeNotVolumePlugin},
+		{ClassifyError(ErrorCodeMountFailed, plain), ErrorCodeMountFailed},
+		// the more specific code is kept
+		{ClassifyError(ErrorCodeMountFailed, &connectivity.ConnectionError{Err: plain}), ErrorCodePluginUnreachable},
+		{ClassifyError(ErrorCodeMountFailed, newError(ErrorCodeVolumeNotFound, "gone")), ErrorCodeVolumeNotFound},
+	}
+	for i, tc := range tests {
+		if code := GetErrorCode(tc.err); code != tc.code {
+			t.Errorf("test %d: for %v expected %s got %s", i, tc.err, tc.code, code)
+		}
+	}
+
+	if ClassifyError(ErrorCodeMountFailed, nil) != nil {
+		t.Error("expected nil to stay nil")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	expectedResponse := "{\"status\":\"Failure\",\"message\":\"/dev/sdb is already mounted at /mnt\",\"code\":\"already-mounted\"}"
+	err := ClassifyError(ErrorCodeMountFailed, &linux.MountedError{Device: "/dev/sdb", MountPoint: "/mnt"})
+	result := BuildJSONResponse(ErrorResponse(err))
+	if result != expectedResponse {
+		t.Errorf("expected response " + expectedResponse + " got " + result)
+	}
+}
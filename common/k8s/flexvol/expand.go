@@ -0,0 +1,95 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hpe-storage/dory/common/linux"
+	"github.com/hpe-storage/dory/common/util"
+	"strconv"
+)
+
+// ExpandVolume grows the docker volume to the new size.
+// args are <json options> <device path> <new size in bytes> <old size in bytes>
+func ExpandVolume(args []string) (string, error) {
+	util.LogDebug.Printf("expandvolume called with %s\n", util.RedactSecrets(fmt.Sprint(args)))
+	err := ensureArg(ExpandVolumeCommand, args, 4)
+	if err != nil {
+		return "", err
+	}
+
+	req := &AttachRequest{}
+	err = json.Unmarshal([]byte(args[0]), req)
+	if err != nil {
+		return "", err
+	}
+
+	newSize, err := strconv.ParseInt(args[2], 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse new size %s - %s", args[2], err.Error())
+	}
+
+	_, err = dvp.Expand(req.getBestName(), newSize)
+	if err != nil {
+		return "", err
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
+
+// ExpandFS grows the filesystem of a volume mounted on this node.
+// args are <json options> <device path> <device mount path> <new size in bytes> <old size in bytes>
+// If the device mount path isn't mounted, the mountpoint reported by the plugin is used.
+func ExpandFS(args []string) (string, error) {
+	util.LogDebug.Printf("expandfs called with %s\n", util.RedactSecrets(fmt.Sprint(args)))
+	req := &AttachRequest{}
+	err := json.Unmarshal([]byte(args[0]), req)
+	if err != nil {
+		return "", err
+	}
+	dockerVolName := req.getBestName()
+
+	mountPoint := ""
+	if len(args) > 2 && args[2] != "" {
+		mount, err := linux.GetMount(args[2])
+		if err != nil {
+			return "", err
+		}
+		if mount != nil {
+			mountPoint = args[2]
+		}
+	}
+
+	if mountPoint == "" {
+		volume, err := getVolume(dockerVolName)
+		if err != nil {
+			return "", err
+		}
+		if volume == nil || volume.Volume.Mountpoint == "" {
+			return "", fmt.Errorf("unable to expand the filesystem of %s, it is not mounted", dockerVolName)
+		}
+		mountPoint = volume.Volume.Mountpoint
+	}
+
+	err = linux.ExpandFileSystem(mountPoint)
+	if err != nil {
+		return "", err
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
@@ -0,0 +1,54 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestExpandVolume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "expand")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	plugin := &testPlugin{}
+	defer startTestPlugin(t, dir, plugin)()
+	dvp.FactorForConversion = 1073741824
+
+	// kubelet calls expandvolume <json options> <device path> <new size> <old size>
+	args := []string{"{\"kubernetes.io/pvOrVolumeName\":\"vol1\"}", "/dev/sdb", "2147483648", "1073741824"}
+	if _, err := ExpandVolume(args); err != nil {
+		t.Fatal(err)
+	}
+	if len(plugin.updates) != 1 {
+		t.Fatalf("expected 1 update got %d", len(plugin.updates))
+	}
+	if plugin.updates[0].Name != "vol1" {
+		t.Error("expected vol1 to be updated got", plugin.updates[0].Name)
+	}
+	if size, ok := plugin.updates[0].Opts["size"].(float64); !ok || size != 2 {
+		t.Error("expected size 2 got", plugin.updates[0].Opts["size"])
+	}
+
+	// the sizes are required
+	if _, err := ExpandVolume(args[:2]); err == nil {
+		t.Error("expected an error without the sizes")
+	}
+}
@@ -19,13 +19,14 @@ package flexvol
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/hpe-storage/dory/common/connectivity"
 	"github.com/hpe-storage/dory/common/docker/dockervol"
 	"github.com/hpe-storage/dory/common/linux"
 	"github.com/hpe-storage/dory/common/util"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -37,10 +38,22 @@ const (
 	AttachCommand = "attach"
 	//DetachCommand - Detach the volume from the kubelet.
 	DetachCommand = "detach"
-	//MountCommand - Mount device mounts the device to a global path which individual pods can then bind mount.
+	//WaitForAttachCommand - Wait for the volume to be attached on the node.
+	WaitForAttachCommand = "waitforattach"
+	//IsAttachedCommand - Check whether the volume is attached to the node.
+	IsAttachedCommand = "isattached"
+	//MountDeviceCommand - Mount device mounts the device to a global path which individual pods can then bind mount.
+	MountDeviceCommand = "mountdevice"
+	//UnmountDeviceCommand - Unmounts the device from the global path.
+	UnmountDeviceCommand = "unmountdevice"
+	//MountCommand - Mount the volume at the pod's path.
 	MountCommand = "mount"
 	//UnmountCommand - Unmounts the filesystem for the device.
 	UnmountCommand = "unmount"
+	//ExpandVolumeCommand - Expand the volume on the storage backend.
+	ExpandVolumeCommand = "expandvolume"
+	//ExpandFSCommand - Expand the filesystem on the node.
+	ExpandFSCommand = "expandfs"
 	//GetVolumeNameCommand - Get the name of the volume.
 	GetVolumeNameCommand = "getvolumename"
 	//SuccessStatus indicates success
@@ -51,33 +64,74 @@ const (
 	NotSupportedStatus = "Not supported"
 	//FailureJSON is a pre-marshalled response used in the case of a marshalling error
 	FailureJSON = "{\"status\":\"Failure\",\"message\":\"Unknown error.\"}"
-	//mountPathRegex describes the uuid and flexvolume name in the path
-	//examples:
-	// /var/lib/origin/openshift.local.volumes/pods/88917cdb-514d-11e7-93fb-5254005e615a/volumes/hpe~nimble/test2
-	// /var/lib/kubelet/pods/fb36bec9-51f7-11e7-8eb8-005056968cbc/volumes/hpe~nimble/test
-	mountPathRegex = "/var/lib/.*/pods/(?P<uuid>[\\w\\d-]*)/volumes/"
 	//docker volume status key
 	devicePathKey  = "devicePath"
-	maxTries       = 3
 	notMounted     = "not mounted"
 	noFileOrDirErr = "no such file or directory"
+	//readOnlyAccess is the value of kubernetes.io/readwrite for read only volumes
+	readOnlyAccess = "ro"
+	//readOnlyOption is passed to the docker volume plugin when a read only volume is created
+	readOnlyOption = "readOnly"
+	//FsGroupChangeAlways changes the group ownership of the volume on every mount
+	FsGroupChangeAlways = "Always"
+	//FsGroupChangeOnRootMismatch only changes the group ownership when the root of the volume doesn't match
+	FsGroupChangeOnRootMismatch = "OnRootMismatch"
+	//FsGroupChangeNever leaves the group ownership of the volume alone
+	FsGroupChangeNever = "Never"
 )
 
 var (
 	//createVolumes indicate whether the driver should create missing volumes
 	createVolumes = true
 
+	//attachEnabled indicates the driver implements the attach/detach call-outs
+	attachEnabled = false
+
+	//fsGroupChangePolicy controls how the fsGroup of a pod is applied to a volume
+	fsGroupChangePolicy = FsGroupChangeAlways
+
 	execPath string
 
+	//socketPath is the resolved docker volume plugin socket
+	socketPath string
+
+	//retryPolicy is shared by every retry in the invocation, including the plugin's
+	retryPolicy = util.DefaultRetryPolicy
+
 	dvp *dockervol.DockerVolumePlugin
 )
 
+//Options controls the flexvol driver behavior
+type Options struct {
+	//EnableAttach causes the driver to report attach support and implement the attach, waitforattach,
+	//isattached, detach, mountdevice and unmountdevice call-outs
+	EnableAttach bool
+	//FsGroupChangePolicy is one of Always, OnRootMismatch or Never
+	FsGroupChangePolicy string
+	//LockDir is the runtime directory for the lock files shared by dory processes on the node
+	LockDir string
+	//LockTimeout is how long to wait for another dory process to release a volume
+	LockTimeout time.Duration
+	//KubeletRootDirs are the candidate kubelet root directories used to parse pod volume paths
+	KubeletRootDirs []string
+	//SelinuxLabel is one of chcon, context or none
+	SelinuxLabel string
+	//SelinuxType is the selinux type volumes are labeled with
+	SelinuxType string
+	//SelinuxLevel is the selinux level volumes are labeled with
+	SelinuxLevel string
+	//RetryPolicy is used for every retry, its deadline should fit inside kubelet's call-out timeout
+	RetryPolicy *util.RetryPolicy
+}
+
 // Response containers the required information for each invocation
 type Response struct {
 	//"status": "<Success/Failure/Not Supported>",
 	Status string `json:"status"`
 	//"message": "<Reason for success/failure>",
 	Message string `json:"message,omitempty"`
+	//"code": "<Stable classification of a failure, one of the ErrorCode constants>"
+	Code string `json:"code,omitempty"`
 	//"device": "<Path to the device attached. This field is valid only for attach calls>"
 	Device string `json:"device,omitempty"`
 	//"volumeName:" "undocumented"
@@ -94,6 +148,17 @@ type AttachRequest struct {
 	PvOrVolumeName string `json:"kubernetes.io/pvOrVolumeName,omitempty"`
 	FsType         string `json:"kubernetes.io/fsType,omitempty"`
 	ReadWrite      string `json:"kubernetes.io/readwrite,omitempty"`
+	FsGroup        string `json:"kubernetes.io/fsGroup,omitempty"`
+	//MounterFsGroup is the fsGroup passed by newer kubelets
+	MounterFsGroup string `json:"kubernetes.io/mounterArgs.FsGroup,omitempty"`
+	//MountOptions is the comma separated list of the PV's mountOptions
+	MountOptions string `json:"kubernetes.io/mountOptions,omitempty"`
+	//SelinuxLabel, SelinuxType and SelinuxLevel override the driver's selinux labeling for this volume
+	SelinuxLabel string `json:"selinuxLabel,omitempty"`
+	SelinuxType  string `json:"selinuxType,omitempty"`
+	SelinuxLevel string `json:"selinuxLevel,omitempty"`
+	//VolumeMode is Block for raw block volumes
+	VolumeMode string `json:"volumeMode,omitempty"`
 }
 
 func (ar *AttachRequest) getBestName() string {
@@ -103,14 +168,79 @@ func (ar *AttachRequest) getBestName() string {
 	return ar.PvOrVolumeName
 }
 
+func (ar *AttachRequest) isReadOnly() bool {
+	return ar.ReadWrite == readOnlyAccess
+}
+
+func (ar *AttachRequest) getMountOptions() []string {
+	var options []string
+	for _, option := range strings.Split(ar.MountOptions, ",") {
+		option = strings.TrimSpace(option)
+		if option != "" {
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+func (ar *AttachRequest) getFsGroup() string {
+	if ar.MounterFsGroup != "" {
+		return ar.MounterFsGroup
+	}
+	return ar.FsGroup
+}
+
 // Config controls the docker behavior
-func Config(ePath string, options *dockervol.Options) (err error) {
-	dvp, err = dockervol.NewDockerVolumePlugin(options)
+func Config(ePath string, options *dockervol.Options, flexOptions *Options) (err error) {
 	createVolumes = options.CreateVolumes
 	execPath = ePath
+	if flexOptions != nil {
+		attachEnabled = flexOptions.EnableAttach
+		if flexOptions.FsGroupChangePolicy != "" {
+			fsGroupChangePolicy = flexOptions.FsGroupChangePolicy
+		}
+		if flexOptions.LockDir != "" {
+			lockDir = flexOptions.LockDir
+		}
+		if flexOptions.LockTimeout > 0 {
+			lockTimeout = flexOptions.LockTimeout
+		}
+		if len(flexOptions.KubeletRootDirs) > 0 {
+			kubeletRootDirs = flexOptions.KubeletRootDirs
+		}
+		if flexOptions.SelinuxLabel != "" {
+			selinuxLabel = flexOptions.SelinuxLabel
+		}
+		if flexOptions.SelinuxType != "" {
+			selinuxType = flexOptions.SelinuxType
+		}
+		selinuxLevel = flexOptions.SelinuxLevel
+		if flexOptions.RetryPolicy != nil {
+			retryPolicy = flexOptions.RetryPolicy
+		}
+	}
+	// the plugin shares the policy so its retries count against the same deadline
+	if options.RetryPolicy == nil {
+		options.RetryPolicy = retryPolicy
+	}
+	dvp, err = dockervol.NewDockerVolumePlugin(options)
+	socketPath = options.SocketPath
 	return err
 }
 
+// RequiresPlugin returns false for the call-outs that can be answered without contacting the
+// docker volume plugin.  In attach mode attach is invoked by the controller manager which
+// may not have access to the plugin.  Detach and isattached ask the plugin for the volume's state.
+func RequiresPlugin(driverCommand string) bool {
+	switch driverCommand {
+	case GetVolumeNameCommand:
+		return false
+	case AttachCommand:
+		return !attachEnabled
+	}
+	return true
+}
+
 // BuildJSONResponse marshals a message into the FlexVolume JSON Response.
 // If error is not nil, the default Failure message is returned.
 func BuildJSONResponse(response *Response) string {
@@ -125,10 +255,11 @@ func BuildJSONResponse(response *Response) string {
 	return string(jmess)
 }
 
-// ErrorResponse creates a Response with Status and Message set.
+// ErrorResponse creates a Response with Status, Message and Code set.
 func ErrorResponse(err error) *Response {
 	response := &Response{
 		Status: FailureStatus,
+		Code:   GetErrorCode(err),
 	}
 	response.Message = err.Error()
 	return response
@@ -136,7 +267,7 @@ func ErrorResponse(err error) *Response {
 
 //Get a volume (create if necessary) This was added to k8s 1.6
 func Get(jsonRequest string) (string, error) {
-	util.LogInfo.Printf("get called with (%s)\n", jsonRequest)
+	util.LogInfo.Printf("get called with (%s)\n", util.RedactSecrets(jsonRequest))
 	req := &AttachRequest{}
 	err := json.Unmarshal([]byte(jsonRequest), req)
 	if err != nil {
@@ -153,11 +284,30 @@ func Get(jsonRequest string) (string, error) {
 	return BuildJSONResponse(response), nil
 }
 
+//GetVolumeName returns the name kubernetes should use to uniquely identify the volume.  The
+//docker volume name is unique for a given plugin, so it is returned without contacting the
+//plugin.  This allows the call-out to succeed from the controller manager as well as the kubelet.
+func GetVolumeName(jsonRequest string) (string, error) {
+	util.LogDebug.Printf("getvolumename called with %s\n", util.RedactSecrets(jsonRequest))
+	req := &AttachRequest{}
+	err := json.Unmarshal([]byte(jsonRequest), req)
+	if err != nil {
+		return "", err
+	}
+
+	name := req.getBestName()
+	if name == "" {
+		return "", fmt.Errorf("unable to find a volume name in %s", util.RedactSecrets(jsonRequest))
+	}
+
+	return BuildJSONResponse(&Response{Status: SuccessStatus, VolumeName: name}), nil
+}
+
 //Attach doesn't attach a volume.  It simply creates a volume if necessary.  It then returns "Not Supported".
 //This worked well in 1.5 in that it broke the create and mount into 2 timeout windows, but
 //this has changed in 1.6.
 func Attach(jsonRequest string) (string, error) {
-	util.LogDebug.Printf("attach called with %s\n", jsonRequest)
+	util.LogDebug.Printf("attach called with %s\n", util.RedactSecrets(jsonRequest))
 	req := &AttachRequest{}
 	err := json.Unmarshal([]byte(jsonRequest), req)
 	if err != nil {
@@ -173,25 +323,55 @@ func Attach(jsonRequest string) (string, error) {
 }
 
 func getOrCreate(name, jsonRequest string) (string, error) {
-	util.LogDebug.Printf("getOrCreate called with %s and %s\n", name, jsonRequest)
+	util.LogDebug.Printf("getOrCreate called with %s and %s\n", name, util.RedactSecrets(jsonRequest))
 	volume, err := getVolume(name)
 	if err != nil || volume.Volume.Name != name {
 		if !createVolumes {
-			return "", fmt.Errorf("configured to NOT create volumes")
+			return "", newError(ErrorCodeCreateDisabled, "configured to NOT create volumes")
 		}
 
-		util.LogInfo.Printf("volume %s was not found(err=%v), creating a new volume using %v", name, err, jsonRequest)
+		// only one dory process on the node creates a volume at a time
+		lock, err := lockCreate()
+		if err != nil {
+			return "", err
+		}
+		defer lock.unlock()
+		// another dory process may have created the volume while we waited for the lock
+		if volume, err = dvp.Get(name); err == nil && volume != nil && volume.Volume.Name == name {
+			return volume.Volume.Name, nil
+		}
+
+		util.LogInfo.Printf("volume %s was not found(err=%v), creating a new volume using %v", name, err, util.RedactSecrets(jsonRequest))
 		var options map[string]interface{}
-		err := json.Unmarshal([]byte(jsonRequest), &options)
+		err = json.Unmarshal([]byte(jsonRequest), &options)
 		if err != nil {
-			util.LogError.Printf("unable to unmarshal options for %v - %s", jsonRequest, err.Error())
+			util.LogError.Printf("unable to unmarshal options for %v - %s", util.RedactSecrets(jsonRequest), err.Error())
+			return "", err
+		}
+		if err = checkNode(name, options); err != nil {
 			return "", err
 		}
+		ephemeral := isEphemeral(options)
+		removeSelinuxOptions(options)
+		delete(options, ephemeralOption)
+		delete(options, nodeOption)
+		// kubernetes.io options may be stripped, so tell the plugin about read only access explicitly
+		if access, _ := options["kubernetes.io/readwrite"].(string); access == readOnlyAccess {
+			if _, found := options[readOnlyOption]; !found {
+				options[readOnlyOption] = true
+			}
+		}
 		newName, err := dvp.Create(name, options)
 		util.LogDebug.Printf("getOrCreate returning %v for %s", newName, name)
 		if err != nil {
 			return "", err
 		}
+		if ephemeral {
+			// the volume is only deleted if this is recorded, so a failure leaks it rather than failing the mount
+			if err = recordCreated(newName); err != nil {
+				util.LogError.Printf("unable to record the creation of ephemeral volume %s - %s", newName, err.Error())
+			}
+		}
 		return newName, nil
 	}
 
@@ -201,29 +381,29 @@ func getOrCreate(name, jsonRequest string) (string, error) {
 // wrapper for dvp.Get() with retries incorporated
 func getVolume(name string) (volume *dockervol.GetResponse, err error) {
 	util.LogDebug.Printf("getVolume called with %s", name)
-	try := 0
-	for {
-		util.LogDebug.Printf("dvp.Get() called with %s try:%d", name, try+1)
-		volume, err = dvp.Get(name)
+	err = retryPolicy.Do("dvp.Get() of "+name, func(try int) error {
+		util.LogDebug.Printf("dvp.Get() called with %s try:%d", name, try)
+		var getErr error
+		volume, getErr = dvp.Get(name)
 		util.LogDebug.Printf("volume returned from dvp.Get() is %#v", volume)
 		if volume != nil {
-			return volume, nil
+			return nil
 		}
-		if err != nil {
-			if try < maxTries {
-				try++
-				time.Sleep(time.Duration(try) * time.Second)
-				continue
-			}
-			return nil, err
+		// the client has already retried failures to reach the plugin
+		if _, ok := getErr.(*connectivity.ConnectionError); ok {
+			return util.NoRetry(getErr)
 		}
+		return getErr
+	})
+	if volume != nil {
 		return volume, nil
 	}
+	return nil, ClassifyError(ErrorCodeVolumeNotFound, err)
 }
 
 //Mount a volume
 func Mount(args []string) (string, error) {
-	util.LogDebug.Printf("mount called with %v\n", args)
+	util.LogDebug.Printf("mount called with %s\n", util.RedactSecrets(fmt.Sprint(args)))
 	err := ensureArg("mount", args, 2)
 	if err != nil {
 		return "", err
@@ -236,74 +416,158 @@ func Mount(args []string) (string, error) {
 		return "", err
 	}
 
+	err = checkVolumeMode(req)
+	if err != nil {
+		return "", err
+	}
+
 	dockerVolName := req.getBestName()
-	_, err = getOrCreate(dockerVolName, jsonRequest)
+	if attachEnabled {
+		return mountFromDevicePath(args[0], dockerVolName, req)
+	}
+
+	podPath, err := parsePodVolumePath(args[0])
 	if err != nil {
 		return "", err
 	}
+	// the pod uid is used as the docker volume mount id
+	mountID := podPath.PodUID
 
-	mountID, err := getMountID(args[0])
+	lock, err := lockVolume(dockerVolName)
 	if err != nil {
 		return "", err
 	}
+	defer lock.unlock()
 
-	path, err := dvp.Mount(dockerVolName, mountID)
+	// kubelet retries mount, don't stack another mount on top of one we already made
+	mounted, err := isMountedFrom(args[0], dockerVolName)
+	if err != nil {
+		return "", err
+	}
+	if mounted {
+		util.LogInfo.Printf("%s is already mounted at %s", dockerVolName, args[0])
+		return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+	}
+
+	_, err = getOrCreate(dockerVolName, jsonRequest)
 	if err != nil {
 		return "", err
 	}
 
+	path, err := dvp.Mount(dockerVolName, mountID)
+	if err != nil {
+		return "", ClassifyError(ErrorCodeMountFailed, err)
+	}
+
 	//Mkdir
 	err = os.MkdirAll(args[0], 0755)
 	if err != nil {
 		return "", err
 	}
 
-	err = doMount(args[0], path, dockerVolName, mountID)
+	devPath, err := doMount(args[0], path, dockerVolName, req)
 	if err != nil {
-		return "", err
+		return "", ClassifyError(ErrorCodeMountFailed, err)
 	}
 
-	// Set selinux context if configured
-	// References:
-	//    https://github.com/kubernetes/kubernetes/issues/20813
-	//    https://github.com/openshift/origin/issues/741
-	//    https://github.com/projectatomic/atomic-site/blob/master/source/blog/2015-06-15-using-volumes-with-docker-can-cause-problems-with-selinux.html.md
-	err = linux.Chcon("svirt_sandbox_file_t", path)
+	err = applyFsGroup(args[0], req)
 	if err != nil {
+		unmountAfterFailure(args[0], err)
 		return "", err
 	}
 
+	// only a complete mount is recorded, a failed one is unmounted above so kubelet's retry starts over
+	recordVolumeMount(args[0], path, dockerVolName, devPath, mountID)
 	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
 }
 
+// applyFsGroup gives the pod's fsGroup ownership of the volume mounted at path
+func applyFsGroup(path string, req *AttachRequest) error {
+	fsGroup := req.getFsGroup()
+	if fsGroup == "" || req.isReadOnly() || fsGroupChangePolicy == FsGroupChangeNever {
+		return nil
+	}
+	gid, err := strconv.Atoi(fsGroup)
+	if err != nil {
+		return fmt.Errorf("unable to parse fsGroup %s - %s", fsGroup, err.Error())
+	}
+	return linux.SetVolumeOwnership(path, gid, fsGroupChangePolicy == FsGroupChangeOnRootMismatch)
+}
+
 // Unmount a volume
 //nolint :gocyclo
 func Unmount(args []string) (string, error) {
 	util.LogDebug.Printf("Unmount called with %v", args)
-	mountID, err := getMountID(args[0])
+	if attachEnabled {
+		return unmountFromDevicePath(args[0])
+	}
+
+	entry, err := lookupMount(args[0])
+	if err != nil {
+		util.LogError.Printf("Unmount: unable to read mount journal for %s - %s", args[0], err.Error())
+	}
+	if entry != nil {
+		return unmountJournalEntry(entry)
+	}
+
+	podPath, err := parsePodVolumePath(args[0])
 	if err != nil {
 		return "", err
 	}
+	mountID := podPath.PodUID
+
+	mount, err := linux.GetMount(args[0])
+	if err == nil && mount == nil && !hasMountMetadata(args[0]) {
+		return unmountNotMounted(podPath)
+	}
 
 	devPath, err := linux.GetDeviceFromMountPoint(args[0])
 	if err != nil {
 		return "", err
 	}
 
+	// held across the bind unmount, as in unmountJournalEntry, so it can't race a mount of the volume
+	dockerVolumeName := podPath.VolumeName
+	lock, err := lockVolume(dockerVolumeName)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
 	util.LogDebug.Printf("Umount of \"%s\" from %s", args[0], devPath)
 	err = linux.BindUnmount(args[0])
 	if err != nil && !strings.Contains(err.Error(), notMounted) {
 		return "", err
 	}
 
-	dockerPath, metadata, err := retryGetDockerPathAndMetadata(args[0], devPath)
-	if err != nil && !strings.Contains(strings.ToLower(err.Error()), noFileOrDirErr) {
+	var metadata string
+	dockerPath, err := getDockerPathFromPlugin(dockerVolumeName, devPath)
+	if err != nil {
 		return "", err
 	}
+	if dockerPath != "" && hasMountMetadata(args[0]) {
+		metadata, _ = getMountMetadataPath(args[0])
+	} else if dockerPath == "" {
+		// the plugin doesn't know the volume by the name in the path, so work back from the device
+		dockerPath, metadata, err = retryGetDockerPathAndMetadata(args[0], devPath)
+		if err != nil && !strings.Contains(strings.ToLower(err.Error()), noFileOrDirErr) {
+			return "", err
+		}
 
-	dockerVolumeName, err := retryGetVolumeNameFromMountPath(args[0], dockerPath)
-	if err != nil {
-		return "", err
+		dockerVolumeName, err = retryGetVolumeNameFromMountPath(args[0], dockerPath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if dockerVolumeName != podPath.VolumeName {
+		// the plugin knows the volume by another name, which is what its mounts lock
+		var volumeLock *nodeLock
+		volumeLock, err = lockVolume(dockerVolumeName)
+		if err != nil {
+			return "", err
+		}
+		defer volumeLock.unlock()
 	}
 
 	util.LogDebug.Printf("docker unmount of %s %s", dockerVolumeName, mountID)
@@ -323,39 +587,138 @@ func Unmount(args []string) (string, error) {
 		util.LogDebug.Printf("Unmount: dockerVolumeName=%s still has an active mount at %s.", dockerVolumeName, dockerPath)
 	}
 
+	err = deleteIfEphemeral(dockerVolumeName)
+	if err != nil {
+		return "", err
+	}
+
 	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
 }
 
-// retry getVolumeNameFromMountPath for maxTries
-func retryGetVolumeNameFromMountPath(k8sPath, dockerPath string) (string, error) {
-	util.LogDebug.Printf("retryGetVolumeNameFromMountPath called with %s %s", k8sPath, dockerPath)
-	try := 0
-	for {
-		util.LogDebug.Printf("getVolumeNameFromMountPath called with %s %s try:%d", k8sPath, dockerPath, try+1)
-		dockerVolumeName, err := getVolumeNameFromMountPath(k8sPath, dockerPath)
-		if err != nil {
-			if try < maxTries {
-				try++
-				time.Sleep(time.Duration(try) * time.Second)
-				continue
-			}
+// unmountJournalEntry unmounts the k8s path and docker volume recorded in entry
+func unmountJournalEntry(entry *MountEntry) (string, error) {
+	util.LogDebug.Printf("Umount of \"%s\" using journal entry %+v", entry.K8sPath, entry)
+	lock, err := lockVolume(entry.DockerVolume)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
+	err = linux.BindUnmount(entry.K8sPath)
+	if err != nil && !strings.Contains(err.Error(), notMounted) {
+		return "", err
+	}
+
+	util.LogDebug.Printf("docker unmount of %s %s", entry.DockerVolume, entry.MountID)
+	err = dvp.Unmount(entry.DockerVolume, entry.MountID)
+	if err != nil && !strings.Contains(err.Error(), notMounted) {
+		return "", err
+	}
+
+	err = forgetMount(entry.K8sPath)
+	if err != nil {
+		util.LogError.Printf("Unmount: unable to remove %s from the mount journal - %s", entry.K8sPath, err.Error())
+	}
+
+	err = deleteIfEphemeral(entry.DockerVolume)
+	if err != nil {
+		return "", err
+	}
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
+}
+
+// unmountNotMounted handles an unmount of a path that isn't mounted and has no journal entry or
+// breadcrumb, usually a retry of an unmount that already succeeded.  The docker volume named by the
+// path is only unmounted if the plugin still has it mounted.
+func unmountNotMounted(podPath *PodVolumePath) (string, error) {
+	dockerVolName := podPath.VolumeName
+	mountID := podPath.PodUID
+	util.LogInfo.Printf("Unmount: %s is not mounted, checking docker volume %s", podPath.Path, dockerVolName)
+	lock, err := lockVolume(dockerVolName)
+	if err != nil {
+		return "", err
+	}
+	defer lock.unlock()
+
+	dockerPath, err := getPluginPath(dockerVolName)
+	if err != nil {
+		return "", err
+	}
+	if dockerPath == "" {
+		util.LogDebug.Printf("Unmount: docker volume %s isn't mounted by the plugin", dockerVolName)
+	} else {
+		util.LogDebug.Printf("docker unmount of %s %s", dockerVolName, mountID)
+		err = dvp.Unmount(dockerVolName, mountID)
+		if err != nil && !strings.Contains(err.Error(), notMounted) {
 			return "", err
 		}
-		util.LogDebug.Printf("dockerVolumeName %s found at k8sPath :%s", dockerVolumeName, k8sPath)
-		return dockerVolumeName, nil
 	}
+
+	// a retry of an unmount whose delete failed
+	err = deleteIfEphemeral(dockerVolName)
+	if err != nil {
+		return "", err
+	}
+	return BuildJSONResponse(&Response{Status: SuccessStatus}), nil
 }
 
-func getMountID(path string) (string, error) {
-	util.LogDebug.Printf("getMountID called with %v\n", path)
-	r := regexp.MustCompile(mountPathRegex)
-	groups := r.FindStringSubmatch(path)
-	if len(groups) < 2 {
-		return "", fmt.Errorf("unable to split %s", path)
+// isMountedFrom returns true if k8sPath is already mounted from dockerVolName.  An error is
+// returned if k8sPath is mounted from something else.
+func isMountedFrom(k8sPath, dockerVolName string) (bool, error) {
+	mount, err := linux.GetMount(k8sPath)
+	if err != nil || mount == nil {
+		return false, err
+	}
+
+	entry, err := lookupMount(k8sPath)
+	if err == nil && entry != nil {
+		if entry.DockerVolume == dockerVolName {
+			return true, nil
+		}
+		return false, newError(ErrorCodeAlreadyMounted, "%s is already mounted from docker volume %s", k8sPath, entry.DockerVolume)
 	}
-	util.LogDebug.Printf("getMountID returning \"%s\"", groups[1])
-	return groups[1], nil
 
+	// no journal entry, so compare the device with the one the plugin is using
+	volume, err := dvp.Get(dockerVolName)
+	if err == nil && volume != nil {
+		if volume.Volume.Mountpoint != "" {
+			devPath, _ := linux.GetDeviceFromMountPoint(volume.Volume.Mountpoint)
+			if devPath != "" && devPath == mount.Device.Pathname {
+				return true, nil
+			}
+		}
+		if devPath, _ := volume.Volume.Status[devicePathKey].(string); devPath != "" && devPath == mount.Device.Pathname {
+			return true, nil
+		}
+	}
+	return false, newError(ErrorCodeAlreadyMounted, "%s is already mounted from %s which isn't docker volume %s", k8sPath, mount.Device.Pathname, dockerVolName)
+}
+
+// hasMountMetadata returns true if a breadcrumb from an earlier version exists for flexvolPath
+func hasMountMetadata(flexvolPath string) bool {
+	metadata, err := getMountMetadataPath(flexvolPath)
+	if err != nil {
+		return false
+	}
+	is, _, _ := util.FileExists(metadata)
+	return is
+}
+
+// retry getVolumeNameFromMountPath using the retry policy
+func retryGetVolumeNameFromMountPath(k8sPath, dockerPath string) (string, error) {
+	util.LogDebug.Printf("retryGetVolumeNameFromMountPath called with %s %s", k8sPath, dockerPath)
+	var dockerVolumeName string
+	err := retryPolicy.Do("getVolumeNameFromMountPath of "+k8sPath, func(try int) error {
+		util.LogDebug.Printf("getVolumeNameFromMountPath called with %s %s try:%d", k8sPath, dockerPath, try)
+		var err error
+		dockerVolumeName, err = getVolumeNameFromMountPath(k8sPath, dockerPath)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+	util.LogDebug.Printf("dockerVolumeName %s found at k8sPath :%s", dockerVolumeName, k8sPath)
+	return dockerVolumeName, nil
 }
 
 //nolint : gocyclo
@@ -364,11 +727,11 @@ func getVolumeNameFromMountPath(k8sPath, dockerPath string) (string, error) {
 	// sometimes the dockerPath is empty in case of failover/failback scenarios for OSP 3.11 and greater make sure we return the volume if it exists mounted
 	if dockerPath == "" && k8sPath != "" {
 		//if docker path is empty but k8sPath exist, try to use that to the unmount try to use k8s path for volume name
-		volNames := strings.Split(k8sPath, "/")
-		if len(volNames) == 0 || volNames[len(volNames)-1] == "" {
-			return "", fmt.Errorf("no volume found from k8s path %s", k8sPath)
+		podPath, err := parsePodVolumePath(k8sPath)
+		if err != nil {
+			return "", newError(ErrorCodeVolumeNotFound, "no volume found from k8s path %s - %s", k8sPath, err.Error())
 		}
-		return volNames[len(volNames)-1], nil
+		return podPath.VolumeName, nil
 	}
 	name := filepath.Base(dockerPath)
 	dockerVolume, err := getVolume(name)
@@ -387,7 +750,7 @@ func getVolumeNameFromMountPath(k8sPath, dockerPath string) (string, error) {
 				return vol.Name, nil
 			}
 		}
-		return "", fmt.Errorf("unable to find docker volume for %s.  No docker volume claimed to be mounted at %s", k8sPath, dockerPath)
+		return "", newError(ErrorCodeVolumeNotFound, "unable to find docker volume for %s.  No docker volume claimed to be mounted at %s", k8sPath, dockerPath)
 	}
 	if dockerVolume.Volume.Mountpoint == "" {
 		// it could be mounted by other host, so don't treat it as an error
@@ -403,33 +766,66 @@ func getVolumeNameFromMountPath(k8sPath, dockerPath string) (string, error) {
 	return dockerVolume.Volume.Name, nil
 }
 
+// getDockerPathFromPlugin asks the plugin where dockerVolName is mounted.  The path is only
+// returned if devPath is mounted there, or if the plugin's mounts aren't visible from here.
+func getDockerPathFromPlugin(dockerVolName, devPath string) (string, error) {
+	dockerPath, err := getPluginPath(dockerVolName)
+	if err != nil || dockerPath == "" {
+		util.LogDebug.Printf("getDockerPathFromPlugin: no path for docker volume %s (err=%v)", dockerVolName, err)
+		return "", err
+	}
+
+	mountedDevice, err := linux.GetDeviceFromMountPoint(dockerPath)
+	if err != nil {
+		return "", err
+	}
+	if mountedDevice != "" && mountedDevice != devPath {
+		util.LogInfo.Printf("getDockerPathFromPlugin: docker volume %s is mounted at %s from %s, not %s", dockerVolName, dockerPath, mountedDevice, devPath)
+		return "", nil
+	}
+	util.LogDebug.Printf("getDockerPathFromPlugin: docker volume %s is mounted at %s", dockerVolName, dockerPath)
+	return dockerPath, nil
+}
+
+// getPluginPath returns where the plugin has mounted the docker volume.  An empty path means
+// it isn't mounted or the plugin doesn't know the volume.  Any other error, such as a timeout,
+// is returned so kubelet retries rather than the volume being left mounted.
+func getPluginPath(dockerVolName string) (string, error) {
+	dockerPath, err := dvp.Path(dockerVolName)
+	if err != nil {
+		if isNotFoundOrNotMounted(err) {
+			util.LogDebug.Printf("docker volume %s isn't mounted by the plugin - %s", dockerVolName, err.Error())
+			return "", nil
+		}
+		return "", err
+	}
+	return dockerPath, nil
+}
+
+// isNotFoundOrNotMounted returns true if the plugin said it doesn't know the volume or it isn't mounted
+func isNotFoundOrNotMounted(err error) bool {
+	return strings.Contains(err.Error(), dockervol.NotFound) || strings.Contains(err.Error(), notMounted)
+}
+
 func retryGetDockerPathAndMetadata(flexvolPath, devPath string) (string, string, error) {
 	util.LogDebug.Printf("retryGetDockerPathAndMetadata called with flexvolPath(%s) devPath(%s)", flexvolPath, devPath)
-	maxTries := 3
-	try := 0
-	for {
-		dockerPath, metadata, err := getDockerPathAndMetadata(flexvolPath, devPath)
+	var dockerPath, metadata string
+	err := retryPolicy.Do("getDockerPathAndMetadata of "+flexvolPath, func(try int) error {
+		util.LogDebug.Printf("try=%d", try)
+		var err error
+		dockerPath, metadata, err = getDockerPathAndMetadata(flexvolPath, devPath)
 		if err != nil {
 			util.LogError.Printf("getDockerPathAndMetadata failed for flexvolPath %s, devPath %s : %s", flexvolPath, devPath, err.Error())
-			if try < maxTries {
-				try++
-				util.LogDebug.Printf("try=%d", try)
-				time.Sleep(time.Duration(try) * time.Second)
-				continue
-			}
-			return dockerPath, metadata, err
 		}
-		if err != nil {
-			return dockerPath, metadata, err
-		}
-		return dockerPath, metadata, nil
-	}
+		return err
+	})
+	return dockerPath, metadata, err
 }
 
 func findJSON(args []string, req *AttachRequest) (string, error) {
 	var err error
 	for i := 1; i < len(args); i++ {
-		util.LogDebug.Printf("findJSON(%d) about to unmarshal %v", i, args[i])
+		util.LogDebug.Printf("findJSON(%d) about to unmarshal %v", i, util.RedactSecrets(args[i]))
 		err = json.Unmarshal([]byte(args[i]), req)
 		if err == nil {
 			return args[i], nil
@@ -471,10 +867,12 @@ func getDockerPathAndMetadata(flexvolPath, devPath string) (string, string, erro
 	return dockerPath, metadata, nil
 }
 
-func doMount(flexvolPath, dockerPath, dockerName, mountID string) error {
+// doMount mounts the docker volume at flexvolPath returning the device.  If the mount can't be
+// completed, flexvolPath is unmounted.
+func doMount(flexvolPath, dockerPath, dockerName string, req *AttachRequest) (string, error) {
 	devPath, err := linux.GetDeviceFromMountPoint(dockerPath)
 	if err != nil {
-		return err
+		return "", err
 	}
 
 	if devPath == "" {
@@ -487,44 +885,107 @@ func doMount(flexvolPath, dockerPath, dockerName, mountID string) error {
 		var volRes *dockervol.GetResponse
 		volRes, err = dvp.Get(dockerName)
 		if err != nil {
-			return err
+			return "", ClassifyError(ErrorCodeVolumeNotFound, err)
 		}
 
-		devPath, found := volRes.Volume.Status[devicePathKey].(string)
+		var found bool
+		devPath, found = volRes.Volume.Status[devicePathKey].(string)
 		if !found || devPath == "" {
 			util.LogError.Printf("Unable to get device for flexvolPath=%s from docker volume=%+v (path=%s)", flexvolPath, volRes, dockerPath)
-			return fmt.Errorf("Unable to get device for flexvolPath=%s from docker volume=%s", flexvolPath, dockerPath)
+			return "", fmt.Errorf("Unable to get device for flexvolPath=%s from docker volume=%s", flexvolPath, dockerPath)
 		}
 		util.LogDebug.Printf("doMount: found devPath=%s for volume=%s", devPath, dockerName)
 
 		//mount devicePath onto flexvolPath
-		_, err = linux.MountDeviceWithFileSystem(devPath, flexvolPath)
+		_, err = linux.MountDeviceWithFileSystem(devPath, flexvolPath, req.getDeviceMountOptions())
 		if err != nil {
-			return err
+			return "", err
 		}
 		util.LogDebug.Printf("doMount: mounted devPath=%s at flexvolPath=%s", devPath, flexvolPath)
 
-		//create a hidden file in the flexvolume path that maps flexvolume mount to the docker volume (breadcrumb)
-		var metadata string
-		metadata, err = getMountMetadataPath(flexvolPath)
-		if err != nil {
-			return err
-		}
-		err = ioutil.WriteFile(metadata, []byte(dockerPath), 0600)
+		// label before the read only remount
+		err = applySelinuxLabel(flexvolPath, req, false)
 		if err != nil {
-			return err
+			unmountAfterFailure(flexvolPath, err)
+			return "", err
 		}
-		util.LogDebug.Printf("doMount: stored dockerPath=%s at metadata=%s", dockerPath, metadata)
 
+		if req.isReadOnly() {
+			err = remountReadOnly(flexvolPath, false)
+			if err != nil {
+				return "", err
+			}
+		}
 	} else {
 		//bind mount the docker path to the flexvol path
-		err = linux.BindMount(dockerPath, flexvolPath, false)
+		err = linux.BindMount(dockerPath, flexvolPath, false, req.getMountOptions())
+		if err != nil {
+			return "", err
+		}
 		util.LogDebug.Printf("doMount: bind mounted dockerPath=%s at flexvolPath=%s", dockerPath, flexvolPath)
+
+		err = applySelinuxLabel(flexvolPath, req, true)
+		if err != nil {
+			unmountAfterFailure(flexvolPath, err)
+			return "", err
+		}
+
+		if req.isReadOnly() {
+			err = remountReadOnly(flexvolPath, true)
+			if err != nil {
+				return "", err
+			}
+		}
 	}
 
-	return err
+	return devPath, nil
+}
+
+// recordVolumeMount records the mount so unmount can find the docker volume even if the plugin
+// has moved on.  A failure is only logged since the mount itself succeeded.
+func recordVolumeMount(flexvolPath, dockerPath, dockerName, devPath, mountID string) {
+	// the global device mount path in attach mode doesn't belong to a pod
+	podUID := ""
+	if podPath, err := parsePodVolumePath(flexvolPath); err == nil {
+		podUID = podPath.PodUID
+	}
+	err := recordMount(&MountEntry{
+		PodUID:       podUID,
+		K8sPath:      flexvolPath,
+		DockerPath:   dockerPath,
+		DockerVolume: dockerName,
+		Device:       devPath,
+		MountID:      mountID,
+		Socket:       socketPath,
+	})
+	if err != nil {
+		util.LogError.Printf("unable to record mount of %s at %s - %s", dockerName, flexvolPath, err.Error())
+	}
+}
+
+// remountReadOnly remounts the path read only.  If that fails the path is unmounted rather
+// than leaving a read only volume writable.
+func remountReadOnly(path string, bind bool) error {
+	err := linux.RemountReadOnly(path, bind)
+	if err != nil {
+		unmountAfterFailure(path, err)
+		return err
+	}
+	return nil
+}
+
+// unmountAfterFailure unmounts a path whose mount couldn't be completed.  Otherwise kubelet's
+// retry would find the path mounted and report success.
+func unmountAfterFailure(path string, err error) {
+	util.LogError.Printf("unable to complete the mount at %s, unmounting - %s", path, err.Error())
+	err = linux.BindUnmount(path)
+	if err != nil {
+		util.LogError.Printf("unable to unmount %s - %s", path, err.Error())
+	}
 }
 
+// getMountMetadataPath returns the path of the breadcrumb written by earlier versions.  New mounts
+// are recorded in the mount journal, but the breadcrumb is still honored for volumes mounted before an upgrade.
 func getMountMetadataPath(flexvolPath string) (string, error) {
 	_, flexvolFilename := filepath.Split(flexvolPath)
 	if flexvolFilename == "" {
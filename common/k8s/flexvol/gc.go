@@ -0,0 +1,275 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/linux"
+	"github.com/hpe-storage/dory/common/util"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	//OrphanMount is a pod volume that is still mounted for a pod that isn't running
+	OrphanMount = "mount"
+	//OrphanDirectory is a pod volume directory left behind without a mount
+	OrphanDirectory = "directory"
+	//OrphanJournal is a mount journal entry for a path that isn't mounted
+	OrphanJournal = "journal"
+	//OrphanBreadcrumb is a breadcrumb left by an earlier version for a volume that isn't mounted
+	OrphanBreadcrumb = "breadcrumb"
+)
+
+//Orphan is something left behind on the node for a pod that no longer exists
+type Orphan struct {
+	Kind         string `json:"kind"`
+	Path         string `json:"path"`
+	DockerVolume string `json:"dockerVolume,omitempty"`
+	//MountID is the docker volume mount id the plugin is asked to unmount.  It's from the orphan's journal
+	//entry or, without one, the pod uid that mount uses.  It's empty in attach mode without an entry since
+	//the plugin only knows about the global device mount paths.
+	MountID string `json:"mountID,omitempty"`
+	Cleaned bool   `json:"cleaned"`
+	Error   string `json:"error,omitempty"`
+}
+
+//GCOptions controls CollectGarbage
+type GCOptions struct {
+	//DryRun only reports the orphans
+	DryRun bool
+	//MinAge protects mounts recorded and pod volume directories created more recently than this
+	MinAge time.Duration
+	//PodExists reports whether the pod still exists on this node.  Pod volumes, mounted or not, are
+	//only orphans if this is set and returns false.
+	PodExists func(podUID string) (bool, error)
+}
+
+//CollectGarbage finds the pod mounts, pod volume directories, journal entries and breadcrumbs
+//left behind by this driver for pods that no longer exist and cleans them up unless options.DryRun
+//is set.  Cleaning up unmounts the pod path and asks the plugin to unmount the journal entry's mount id,
+//or the pod uid if there's no entry.
+func CollectGarbage(options *GCOptions) ([]*Orphan, error) {
+	util.LogDebug.Printf("CollectGarbage called with %+v", options)
+	orphans, err := findOrphans(options, time.Now())
+	if err != nil || options.DryRun {
+		return orphans, err
+	}
+
+	for _, orphan := range orphans {
+		err = cleanOrphan(orphan)
+		if err != nil {
+			util.LogError.Printf("unable to clean up %+v - %s", orphan, err.Error())
+			orphan.Error = err.Error()
+			continue
+		}
+		util.LogInfo.Printf("cleaned up %+v", orphan)
+		orphan.Cleaned = true
+	}
+	return orphans, nil
+}
+
+// findOrphans returns the orphans for this driver.  Breadcrumbs are last so the directories
+// that recover their mount ids are cleaned up first.
+func findOrphans(options *GCOptions, now time.Time) ([]*Orphan, error) {
+	var journal *mountJournal
+	err := updateJournal(func(j *mountJournal) bool {
+		journal = j
+		return false
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var orphans []*Orphan
+	seen := make(map[string]bool)
+	mountedVolumes := make(map[string]bool)
+	for _, path := range getPodVolumeDirs() {
+		seen[path] = true
+		podPath, err := parsePodVolumePath(path)
+		if err != nil {
+			continue
+		}
+		orphan := &Orphan{Kind: OrphanDirectory, Path: path, DockerVolume: podPath.VolumeName}
+		entry := journal.Entries[path]
+		if entry != nil {
+			orphan.DockerVolume = entry.DockerVolume
+			orphan.MountID = entry.MountID
+		} else if !attachEnabled {
+			// mounted by an earlier version or the entry was lost, mount used the pod uid as the mount id
+			orphan.MountID = podPath.PodUID
+		}
+
+		mount, err := linux.GetMount(path)
+		if err != nil {
+			return nil, err
+		}
+		if mount != nil {
+			orphan.Kind = OrphanMount
+			mountedVolumes[podPath.VolumeName] = true
+		}
+
+		// kubelet creates the directory before it calls the driver, so a mount may be in progress
+		if isRecent(path, entry, options.MinAge, now) || options.PodExists == nil {
+			continue
+		}
+		exists, err := options.PodExists(podPath.PodUID)
+		if err != nil {
+			util.LogError.Printf("unable to tell if pod %s exists, leaving %s alone - %s", podPath.PodUID, path, err.Error())
+			continue
+		}
+		if !exists {
+			orphans = append(orphans, orphan)
+		}
+	}
+
+	for path, entry := range journal.Entries {
+		if seen[path] {
+			continue
+		}
+		if mount, err := linux.GetMount(path); err != nil || mount != nil {
+			continue
+		}
+		orphans = append(orphans, &Orphan{Kind: OrphanJournal, Path: path, DockerVolume: entry.DockerVolume, MountID: entry.MountID})
+	}
+
+	dir := filepath.Dir(execPath)
+	for name := range getBreadcrumbs() {
+		if !mountedVolumes[name] {
+			orphans = append(orphans, &Orphan{Kind: OrphanBreadcrumb, Path: filepath.Join(dir, "."+name), DockerVolume: name})
+		}
+	}
+	return orphans, nil
+}
+
+// isRecent returns true if the journal entry, or the directory if there's no entry, was created less than minAge ago
+func isRecent(path string, entry *MountEntry, minAge time.Duration, now time.Time) bool {
+	if entry != nil {
+		return now.Sub(entry.Created) < minAge
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return now.Sub(info.ModTime()) < minAge
+}
+
+// getPodVolumeDirs returns the pod volume directories for this driver in all of the kubelet root directories
+func getPodVolumeDirs() []string {
+	driver := filepath.Base(filepath.Dir(execPath))
+	var dirs []string
+	for _, root := range kubeletRootDirs {
+		matches, err := filepath.Glob(filepath.Join(root, podsDir, "*", volumesDir, driver, "*"))
+		if err != nil {
+			util.LogError.Printf("unable to find pod volumes in %s - %s", root, err.Error())
+			continue
+		}
+		dirs = append(dirs, matches...)
+	}
+	sort.Strings(dirs)
+	return dirs
+}
+
+// cleanOrphan cleans up a single orphan while holding the volume lock, so it can't race a mount
+// or unmount of the same volume.
+func cleanOrphan(orphan *Orphan) error {
+	if orphan.Kind == OrphanBreadcrumb {
+		err := os.Remove(orphan.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	lock, err := lockVolume(orphan.DockerVolume)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	mount, err := linux.GetMount(orphan.Path)
+	if err != nil {
+		return err
+	}
+	switch orphan.Kind {
+	case OrphanMount:
+		if mount != nil {
+			err = linux.BindUnmount(orphan.Path)
+			if err != nil && !strings.Contains(err.Error(), notMounted) {
+				return err
+			}
+		}
+	default:
+		if mount != nil {
+			return fmt.Errorf("%s was mounted after it was found", orphan.Path)
+		}
+	}
+
+	// in attach mode the plugin only knows about the global device mount paths, which are journal entries
+	if orphan.MountID != "" && (!attachEnabled || orphan.Kind == OrphanJournal) {
+		err = unmountOrphan(orphan)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = forgetMount(orphan.Path)
+	if err != nil {
+		return err
+	}
+
+	// unmountOrphan leaves the plugin alone in attach mode, so the volume may still be mounted there
+	if !attachEnabled || orphan.Kind == OrphanJournal {
+		err = deleteIfEphemeral(orphan.DockerVolume)
+		if err != nil {
+			return err
+		}
+	}
+
+	if orphan.Kind != OrphanJournal {
+		// only removes the directory if it's empty
+		err = os.Remove(orphan.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// unmountOrphan asks the plugin to unmount the orphan's mount id.  Orphans that were no longer
+// mounted are only unmounted if the plugin still reports the volume as mounted.
+func unmountOrphan(orphan *Orphan) error {
+	if orphan.Kind != OrphanMount {
+		path, err := getPluginPath(orphan.DockerVolume)
+		if err != nil {
+			return err
+		}
+		if path == "" {
+			util.LogDebug.Printf("docker volume %s isn't mounted by the plugin", orphan.DockerVolume)
+			return nil
+		}
+	}
+	util.LogDebug.Printf("docker unmount of %s %s", orphan.DockerVolume, orphan.MountID)
+	err := dvp.Unmount(orphan.DockerVolume, orphan.MountID)
+	if err != nil && !strings.Contains(err.Error(), notMounted) {
+		return err
+	}
+	return nil
+}
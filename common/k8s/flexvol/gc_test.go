@@ -0,0 +1,175 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCollectGarbageDryRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedExecPath, savedRootDirs := execPath, kubeletRootDirs
+	execPath = filepath.Join(dir, "hpe~nimble", "nimble")
+	kubeletRootDirs = []string{filepath.Join(dir, "kubelet")}
+	defer func() { execPath, kubeletRootDirs = savedExecPath, savedRootDirs }()
+	if err = os.MkdirAll(filepath.Dir(execPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// a pod volume directory left behind after a crash along with its breadcrumb
+	podVolume := filepath.Join(dir, "kubelet", "pods", "uid1", "volumes", "hpe~nimble", "data")
+	if err = os.MkdirAll(podVolume, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(podVolume, old, old); err != nil {
+		t.Fatal(err)
+	}
+	// a directory kubelet just created for a mount in progress and one for a pod that still exists
+	for _, uid := range []string{"uid3", "uid4"} {
+		if err = os.MkdirAll(filepath.Join(dir, "kubelet", "pods", uid, "volumes", "hpe~nimble", "data"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = os.Chtimes(filepath.Join(dir, "kubelet", "pods", "uid4", "volumes", "hpe~nimble", "data"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	breadcrumb := filepath.Join(dir, "hpe~nimble", ".data")
+	if err = ioutil.WriteFile(breadcrumb, []byte("/var/lib/docker/plugins/vol1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// a journal entry for a pod whose directory is gone
+	if err = recordMount(&MountEntry{K8sPath: "/no/such/pod/volume", DockerVolume: "vol2", MountID: "uid2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	podExists := func(podUID string) (bool, error) {
+		return podUID == "uid4", nil
+	}
+	orphans, err := CollectGarbage(&GCOptions{DryRun: true, MinAge: time.Minute, PodExists: podExists})
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := make(map[string]*Orphan)
+	for _, orphan := range orphans {
+		found[orphan.Kind] = orphan
+		if orphan.Cleaned {
+			t.Error("expected nothing to be cleaned in a dry run got", orphan)
+		}
+	}
+	if len(orphans) != 3 {
+		t.Errorf("expected 3 orphans got %d", len(orphans))
+	}
+	// without a journal entry the mount id is the pod uid
+	if o := found[OrphanDirectory]; o == nil || o.Path != podVolume || o.DockerVolume != "data" || o.MountID != "uid1" {
+		t.Errorf("unexpected directory orphan %+v", o)
+	}
+	if o := found[OrphanJournal]; o == nil || o.DockerVolume != "vol2" || o.MountID != "uid2" {
+		t.Errorf("unexpected journal orphan %+v", o)
+	}
+	if o := found[OrphanBreadcrumb]; o == nil || o.Path != breadcrumb {
+		t.Errorf("unexpected breadcrumb orphan %+v", o)
+	}
+
+	if _, err = os.Stat(podVolume); err != nil {
+		t.Error("expected the dry run to leave", podVolume, "got", err)
+	}
+}
+
+func TestCollectGarbageWithoutPodExists(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedExecPath, savedRootDirs := execPath, kubeletRootDirs
+	execPath = filepath.Join(dir, "hpe~nimble", "nimble")
+	kubeletRootDirs = []string{filepath.Join(dir, "kubelet")}
+	defer func() { execPath, kubeletRootDirs = savedExecPath, savedRootDirs }()
+	if err = os.MkdirAll(filepath.Dir(execPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// pod volumes are left alone when there's no way to tell if the pod exists
+	podVolume := filepath.Join(dir, "kubelet", "pods", "uid1", "volumes", "hpe~nimble", "data")
+	if err = os.MkdirAll(podVolume, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(podVolume, old, old); err != nil {
+		t.Fatal(err)
+	}
+	orphans, err := CollectGarbage(&GCOptions{DryRun: true, MinAge: time.Minute})
+	if err != nil || len(orphans) != 0 {
+		t.Errorf("expected no orphans got %v %v", orphans, err)
+	}
+}
+
+func TestCollectGarbageUnmountsPodUID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedExecPath, savedRootDirs, savedLockDir := execPath, kubeletRootDirs, lockDir
+	execPath = filepath.Join(dir, "hpe~nimble", "nimble")
+	kubeletRootDirs = []string{filepath.Join(dir, "kubelet")}
+	lockDir = filepath.Join(dir, "locks")
+	defer func() { execPath, kubeletRootDirs, lockDir = savedExecPath, savedRootDirs, savedLockDir }()
+	if err = os.MkdirAll(filepath.Dir(execPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	plugin := &testPlugin{paths: map[string]string{"data": "/var/lib/plugin/data"}}
+	stop := startTestPlugin(t, dir, plugin)
+	defer stop()
+
+	// a pod volume directory without a journal entry, mounted by an earlier version
+	podVolume := filepath.Join(dir, "kubelet", "pods", "uid1", "volumes", "hpe~nimble", "data")
+	if err = os.MkdirAll(podVolume, 0755); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err = os.Chtimes(podVolume, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	podExists := func(podUID string) (bool, error) {
+		return false, nil
+	}
+	orphans, err := CollectGarbage(&GCOptions{MinAge: time.Minute, PodExists: podExists})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || !orphans[0].Cleaned || orphans[0].MountID != "uid1" {
+		t.Fatalf("expected the directory orphan to be cleaned got %+v", orphans)
+	}
+	// the plugin still reports the volume as mounted, so the pod's mount id is released
+	if len(plugin.unmounts) != 1 || plugin.unmounts[0].Name != "data" || plugin.unmounts[0].ID != "uid1" {
+		t.Errorf("expected an unmount of data uid1 got %+v", plugin.unmounts)
+	}
+	if _, err = os.Stat(podVolume); !os.IsNotExist(err) {
+		t.Error("expected", podVolume, "to be removed got", err)
+	}
+}
@@ -28,7 +28,7 @@ func Handle(driverCommand string, enable16 bool, args []string) string {
 		if enable16 {
 			return BuildJSONResponse(&Response{Status: SuccessStatus})
 		}
-		capabilities := map[string]bool{"attach": false}
+		capabilities := map[string]bool{"attach": attachEnabled, "fsGroup": false, "getVolumeName": true, "requiresFSResize": true}
 		return BuildJSONResponse(&Response{Status: SuccessStatus, DriverCapabilities: capabilities})
 	}
 
@@ -37,15 +37,38 @@ func Handle(driverCommand string, enable16 bool, args []string) string {
 		return BuildJSONResponse(ErrorResponse(err))
 	}
 
+	if attachEnabled {
+		switch driverCommand {
+		case AttachCommand:
+			return attachDevice(args)
+		case WaitForAttachCommand:
+			return waitForAttach(args)
+		case IsAttachedCommand:
+			return isAttached(args)
+		case DetachCommand:
+			return detachVolume(args)
+		case MountDeviceCommand:
+			return mountDevice(args)
+		case UnmountDeviceCommand:
+			return unmountDevice(args)
+		}
+	}
+
 	switch driverCommand {
 	case AttachCommand:
 		return attachVolume(args[0])
+	case GetVolumeNameCommand:
+		return getVolumeName(args[0])
+	case ExpandVolumeCommand:
+		return expandVolume(args)
+	case ExpandFSCommand:
+		return expandFS(args)
 	case MountCommand:
 		return mountVolume(args)
 	case UnmountCommand:
 		return unmountVolume(args)
 	default:
-		util.LogError.Printf("Unsupported command (%s) was called with %s\n", driverCommand, args)
+		util.LogError.Printf("Unsupported command (%s) was called with %s\n", driverCommand, util.RedactSecrets(fmt.Sprint(args)))
 	}
 	return BuildJSONResponse(&Response{Status: NotSupportedStatus, Message: "Not supported."})
 }
@@ -58,6 +81,30 @@ func attachVolume(json string) string {
 	return mess
 }
 
+func getVolumeName(json string) string {
+	mess, err := GetVolumeName(json)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
+func expandVolume(args []string) string {
+	mess, err := ExpandVolume(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
+func expandFS(args []string) string {
+	mess, err := ExpandFS(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
 func mountVolume(args []string) string {
 	mess, err := Mount(args)
 	if err != nil {
@@ -74,6 +121,54 @@ func unmountVolume(args []string) string {
 	return mess
 }
 
+func attachDevice(args []string) string {
+	mess, err := AttachDevice(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
+func waitForAttach(args []string) string {
+	mess, err := WaitForAttach(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
+func isAttached(args []string) string {
+	mess, err := IsAttached(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
+func detachVolume(args []string) string {
+	mess, err := Detach(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
+func mountDevice(args []string) string {
+	mess, err := MountDevice(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
+func unmountDevice(args []string) string {
+	mess, err := UnmountDevice(args)
+	if err != nil {
+		return BuildJSONResponse(ErrorResponse(err))
+	}
+	return mess
+}
+
 func ensureArg(driverCommand string, args []string, number int) error {
 	if len(args) < number {
 		return fmt.Errorf("Not enough arguments for %s", driverCommand)
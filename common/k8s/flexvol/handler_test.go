@@ -1,9 +1,16 @@
 package flexvol
 
-import "testing"
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/hpe-storage/dory/common/util"
+	"log"
+	"strings"
+	"testing"
+)
 
 func TestInitCapabilities(t *testing.T) {
-	expectedInitResponse := "{\"status\":\"Success\",\"capabilities\":{\"attach\":false}}"
+	expectedInitResponse := "{\"status\":\"Success\",\"capabilities\":{\"attach\":false,\"fsGroup\":false,\"getVolumeName\":true,\"requiresFSResize\":true}}"
 	result := Handle("init", false, []string{"foo", "bar"})
 	if result != expectedInitResponse {
 		t.Errorf("init response mismatch. Expected " + expectedInitResponse + " got " + result)
@@ -26,10 +33,68 @@ func TestInvalidCommand(t *testing.T) {
 	}
 }
 
+func TestGetVolumeName(t *testing.T) {
+	expectedResponse := "{\"status\":\"Success\",\"volumeName\":\"vol1\"}"
+	result := Handle("getvolumename", false, []string{"{\"kubernetes.io/pvOrVolumeName\":\"vol1\"}"})
+	if result != expectedResponse {
+		t.Errorf("getvolumename expected response " + expectedResponse + " got " + result)
+	}
+
+	expectedResponse = "{\"status\":\"Success\",\"volumeName\":\"dockervol\"}"
+	result = Handle("getvolumename", false, []string{"{\"name\":\"dockervol\",\"kubernetes.io/pvOrVolumeName\":\"vol1\"}"})
+	if result != expectedResponse {
+		t.Errorf("getvolumename expected response " + expectedResponse + " got " + result)
+	}
+
+	result = Handle("getvolumename", false, []string{"{}"})
+	if !strings.Contains(result, FailureStatus) {
+		t.Errorf("getvolumename expected failure for empty request got " + result)
+	}
+}
+
+func TestGetMountOptions(t *testing.T) {
+	req := &AttachRequest{}
+	err := json.Unmarshal([]byte("{\"kubernetes.io/mountOptions\":\"noatime, nodiscard,,ro\"}"), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	options := strings.Join(req.getMountOptions(), ",")
+	if options != "noatime,nodiscard,ro" {
+		t.Errorf("mountOptions expected noatime,nodiscard,ro got " + options)
+	}
+
+	req = &AttachRequest{}
+	if len(req.getMountOptions()) != 0 {
+		t.Errorf("mountOptions expected none got %v", req.getMountOptions())
+	}
+}
+
 func TestEnsureArgs(t *testing.T) {
 	size := 1
 	err := ensureArg("init", []string{"foo", "bar"}, size)
 	if err != nil {
-		t.Errorf("args size is less than" + string(size))
+		t.Errorf("args size is less than %d", size)
+	}
+}
+
+func TestSecretsAreNotLogged(t *testing.T) {
+	var buffer bytes.Buffer
+	savedDebug, savedInfo, savedError := util.LogDebug, util.LogInfo, util.LogError
+	defer func() { util.LogDebug, util.LogInfo, util.LogError = savedDebug, savedInfo, savedError }()
+	util.LogDebug = log.New(&buffer, "", 0)
+	util.LogInfo = util.LogDebug
+	util.LogError = util.LogDebug
+
+	secret := "c2VjcmV0"
+	request := `{"kubernetes.io/secret/token":"` + secret + `","name":"vol1"}`
+	if _, err := findJSON([]string{"/var/lib/kubelet/pods/uid1/volumes/hpe~nimble/vol1", request}, &AttachRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	result := Handle("getvolumename", false, []string{`{"kubernetes.io/secret/token":"` + secret + `"}`})
+	if strings.Contains(result, secret) {
+		t.Error("expected the secret to be redacted from the response got", result)
+	}
+	if strings.Contains(buffer.String(), secret) {
+		t.Error("expected the secret to be redacted from the log got", buffer.String())
 	}
 }
@@ -0,0 +1,189 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hpe-storage/dory/common/linux"
+	"github.com/hpe-storage/dory/common/util"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	journalFile     = ".mounts.json"
+	journalLockFile = ".mounts.lock"
+	//journalStaleAge is how long an entry for a path that is no longer mounted is kept
+	journalStaleAge = 10 * time.Minute
+)
+
+//MountEntry records a mount made by the driver on this node
+type MountEntry struct {
+	PodUID       string    `json:"podUID,omitempty"`
+	K8sPath      string    `json:"k8sPath"`
+	DockerPath   string    `json:"dockerPath,omitempty"`
+	DockerVolume string    `json:"dockerVolume"`
+	Device       string    `json:"device,omitempty"`
+	MountID      string    `json:"mountID"`
+	Socket       string    `json:"socket,omitempty"`
+	Created      time.Time `json:"created"`
+	Updated      time.Time `json:"updated"`
+}
+
+//mountJournal holds the mount entries keyed by k8s path and the ephemeral volumes created by the
+//driver keyed by docker volume name
+type mountJournal struct {
+	Entries map[string]*MountEntry    `json:"entries"`
+	Created map[string]*CreatedVolume `json:"created,omitempty"`
+}
+
+// getJournalPath returns the path of the journal (or its lock) in the driver directory
+func getJournalPath(name string) (string, error) {
+	if execPath == "" {
+		return "", fmt.Errorf("driver path is not configured")
+	}
+	return filepath.Join(filepath.Dir(execPath), name), nil
+}
+
+// updateJournal calls update with the journal while holding the journal lock.  The journal is
+// saved if update returns true.
+func updateJournal(update func(journal *mountJournal) bool) error {
+	lockPath, err := getJournalPath(journalLockFile)
+	if err != nil {
+		return err
+	}
+	lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	journal, err := loadJournal()
+	if err != nil {
+		return err
+	}
+	if !update(journal) {
+		return nil
+	}
+	return saveJournal(journal)
+}
+
+func loadJournal() (*mountJournal, error) {
+	journal := &mountJournal{Entries: make(map[string]*MountEntry), Created: make(map[string]*CreatedVolume)}
+	path, err := getJournalPath(journalFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return journal, nil
+		}
+		return nil, err
+	}
+	err = json.Unmarshal(data, journal)
+	if err != nil {
+		// a corrupt journal shouldn't block mounts, the legacy lookups still work
+		util.LogError.Printf("unable to parse mount journal %s, starting a new one - %s", path, err.Error())
+		return &mountJournal{Entries: make(map[string]*MountEntry), Created: make(map[string]*CreatedVolume)}, nil
+	}
+	if journal.Entries == nil {
+		journal.Entries = make(map[string]*MountEntry)
+	}
+	if journal.Created == nil {
+		journal.Created = make(map[string]*CreatedVolume)
+	}
+	return journal, nil
+}
+
+// saveJournal writes the journal to a temporary file and renames it so readers never see a partial journal
+func saveJournal(journal *mountJournal) error {
+	path, err := getJournalPath(journalFile)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(journal, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// recordMount adds or updates the entry for entry.K8sPath
+func recordMount(entry *MountEntry) error {
+	util.LogDebug.Printf("recordMount called with %+v", entry)
+	now := time.Now()
+	return updateJournal(func(journal *mountJournal) bool {
+		entry.Created = now
+		if old, found := journal.Entries[entry.K8sPath]; found {
+			entry.Created = old.Created
+		}
+		entry.Updated = now
+		journal.Entries[entry.K8sPath] = entry
+		return true
+	})
+}
+
+// lookupMount returns the entry for k8sPath or nil if there isn't one
+func lookupMount(k8sPath string) (*MountEntry, error) {
+	var entry *MountEntry
+	err := updateJournal(func(journal *mountJournal) bool {
+		entry = journal.Entries[k8sPath]
+		return false
+	})
+	return entry, err
+}
+
+// forgetMount removes the entry for k8sPath and any stale entries
+func forgetMount(k8sPath string) error {
+	util.LogDebug.Printf("forgetMount called with %s", k8sPath)
+	return updateJournal(func(journal *mountJournal) bool {
+		delete(journal.Entries, k8sPath)
+		pruneJournal(journal, time.Now())
+		return true
+	})
+}
+
+// pruneJournal removes entries whose path is no longer mounted.  Recent entries are kept
+// so a mount that is still being set up isn't removed.
+func pruneJournal(journal *mountJournal, now time.Time) {
+	for path, entry := range journal.Entries {
+		if now.Sub(entry.Updated) < journalStaleAge {
+			continue
+		}
+		mount, err := linux.GetMount(path)
+		if err != nil || mount != nil {
+			continue
+		}
+		util.LogInfo.Printf("removing stale mount journal entry %+v", entry)
+		delete(journal.Entries, path)
+	}
+}
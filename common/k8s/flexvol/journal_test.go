@@ -0,0 +1,85 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMountJournal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedExecPath := execPath
+	execPath = filepath.Join(dir, "nimble")
+	defer func() { execPath = savedExecPath }()
+
+	// two pods mounting volumes with the same name shouldn't collide
+	pod1 := "/var/lib/kubelet/pods/uid1/volumes/hpe~nimble/data"
+	pod2 := "/var/lib/kubelet/pods/uid2/volumes/hpe~nimble/data"
+	if err = recordMount(&MountEntry{K8sPath: pod1, DockerVolume: "vol1", MountID: "uid1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err = recordMount(&MountEntry{K8sPath: pod2, DockerVolume: "vol2", MountID: "uid2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	entry, err := lookupMount(pod1)
+	if err != nil || entry == nil || entry.DockerVolume != "vol1" || entry.Created.IsZero() {
+		t.Fatalf("lookupMount(%s) returned %+v, %v", pod1, entry, err)
+	}
+
+	if err = forgetMount(pod1); err != nil {
+		t.Fatal(err)
+	}
+	entry, _ = lookupMount(pod1)
+	if entry != nil {
+		t.Error("expected", pod1, "to be forgotten got", entry)
+	}
+	entry, _ = lookupMount(pod2)
+	if entry == nil || entry.DockerVolume != "vol2" {
+		t.Error("expected", pod2, "to be remembered got", entry)
+	}
+}
+
+func TestPruneJournal(t *testing.T) {
+	now := time.Now()
+	journal := &mountJournal{Entries: map[string]*MountEntry{
+		"/no/such/old":    {K8sPath: "/no/such/old", Updated: now.Add(-2 * journalStaleAge)},
+		"/no/such/recent": {K8sPath: "/no/such/recent", Updated: now},
+	}}
+	pruneJournal(journal, now)
+	if _, found := journal.Entries["/no/such/old"]; found {
+		t.Error("expected stale entry to be pruned")
+	}
+	if _, found := journal.Entries["/no/such/recent"]; !found {
+		t.Error("expected recent entry to be kept")
+	}
+}
+
+func TestIsMountedFromNotMounted(t *testing.T) {
+	mounted, err := isMountedFrom("/no/such/k8s/path", "vol1")
+	if mounted || err != nil {
+		t.Error("expected an unmounted path to not be mounted got", mounted, err)
+	}
+}
@@ -0,0 +1,98 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"github.com/hpe-storage/dory/common/util"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	//DefaultLockDir is the runtime directory holding the lock files shared by dory processes
+	DefaultLockDir = "/var/run/dory"
+	//DefaultLockTimeout is how long to wait for a lock.  It leaves room inside kubelet's call-out deadline.
+	DefaultLockTimeout = 30 * time.Second
+	createLockName     = "create"
+	volumeLockPrefix   = "volume-"
+	lockRetryInterval  = 100 * time.Millisecond
+)
+
+var (
+	lockDir     = DefaultLockDir
+	lockTimeout = DefaultLockTimeout
+)
+
+//nodeLock is a flock held on a file in lockDir.  Every dory process on the node shares these locks.
+type nodeLock struct {
+	name string
+	file *os.File
+}
+
+// lockVolume serializes the operations on a docker volume
+func lockVolume(dockerVolName string) (*nodeLock, error) {
+	// docker volume names shouldn't contain a separator, but don't let one escape the lock directory
+	return acquireLock(volumeLockPrefix + strings.Replace(dockerVolName, string(filepath.Separator), "_", -1))
+}
+
+// lockCreate serializes volume creation on the node
+func lockCreate() (*nodeLock, error) {
+	return acquireLock(createLockName)
+}
+
+func acquireLock(name string) (*nodeLock, error) {
+	err := os.MkdirAll(lockDir, 0700)
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(lockDir, name+".lock")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Now()
+	for {
+		err = syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+		if err == nil {
+			util.LogDebug.Printf("acquired lock %s after %v", path, time.Since(start))
+			return &nodeLock{name: path, file: file}, nil
+		}
+		if err != syscall.EWOULDBLOCK {
+			file.Close()
+			return nil, err
+		}
+		if time.Since(start) >= lockTimeout {
+			file.Close()
+			return nil, newError(ErrorCodeTimeout, "timed out after %v waiting for lock %s", lockTimeout, path)
+		}
+		time.Sleep(lockRetryInterval)
+	}
+}
+
+// unlock releases the lock.  It is safe to call on a nil lock.
+func (l *nodeLock) unlock() {
+	if l == nil {
+		return
+	}
+	syscall.Flock(int(l.file.Fd()), syscall.LOCK_UN)
+	l.file.Close()
+	util.LogDebug.Printf("released lock %s", l.name)
+}
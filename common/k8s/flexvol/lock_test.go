@@ -0,0 +1,67 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestVolumeLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "locks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	savedDir, savedTimeout := lockDir, lockTimeout
+	lockDir, lockTimeout = dir, 200*time.Millisecond
+	defer func() { lockDir, lockTimeout = savedDir, savedTimeout }()
+
+	lock, err := lockVolume("vol1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a different volume isn't blocked
+	other, err := lockVolume("vol2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.unlock()
+
+	// the same volume times out while it is held
+	_, err = lockVolume("vol1")
+	if GetErrorCode(err) != ErrorCodeTimeout {
+		t.Error("expected lock on vol1 to time out got", err)
+	}
+
+	lock.unlock()
+	lock, err = lockVolume("vol1")
+	if err != nil {
+		t.Error("expected lock on vol1 after unlock got", err)
+	}
+	lock.unlock()
+
+	// volume names can't escape the lock directory
+	lock, err = lockVolume("../vol1")
+	if err != nil {
+		t.Error("unexpected error", err)
+	}
+	lock.unlock()
+}
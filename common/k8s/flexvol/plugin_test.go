@@ -0,0 +1,139 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"github.com/hpe-storage/dory/common/util"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+//testPlugin is a docker volume plugin that answers Path from paths and records the volumes it's asked to remove, update or unmount
+type testPlugin struct {
+	//scope is reported by Capabilities, which are only supported if it's set
+	scope string
+	paths map[string]string
+	//volumes answers Get if it's set
+	volumes  map[string]*dockervol.DockerVolume
+	removed  []string
+	updates  []*dockervol.Request
+	unmounts []*dockervol.MountRequest
+}
+
+func (p *testPlugin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	req := &dockervol.Request{}
+	json.Unmarshal(body, req)
+	switch r.URL.Path {
+	case dockervol.ActivateURI:
+		json.NewEncoder(w).Encode(&dockervol.ActivateResponse{Implements: []string{dockervol.VolumeDriver}})
+		return
+	case dockervol.RemoveURI:
+		p.removed = append(p.removed, req.Name)
+	case dockervol.UpdateURI:
+		p.updates = append(p.updates, req)
+	case dockervol.UnmountURI:
+		unmount := &dockervol.MountRequest{}
+		json.Unmarshal(body, unmount)
+		p.unmounts = append(p.unmounts, unmount)
+	case dockervol.CapabilitiesURI:
+		json.NewEncoder(w).Encode(&dockervol.CapResponse{Capabilities: dockervol.PluginCapabilities{Scope: p.scope}})
+		return
+	case dockervol.GetURI:
+		if p.volumes == nil {
+			break
+		}
+		volume, found := p.volumes[req.Name]
+		if !found {
+			fmt.Fprintf(w, "{\"Err\":\"Unable to find %s\"}", req.Name)
+			return
+		}
+		json.NewEncoder(w).Encode(&dockervol.GetResponse{Volume: *volume})
+		return
+	case dockervol.PathURI:
+		path, found := p.paths[req.Name]
+		if !found {
+			fmt.Fprintf(w, "{\"Err\":\"Unable to find %s\"}", req.Name)
+			return
+		}
+		json.NewEncoder(w).Encode(&dockervol.MountResponse{Mountpoint: path})
+		return
+	}
+	w.Write([]byte("{}"))
+}
+
+// startTestPlugin serves plugin on a socket in dir and points dvp and socketPath at it.  The
+// returned function stops the plugin and restores them.
+func startTestPlugin(t *testing.T, dir string, plugin *testPlugin) func() {
+	savedSocketPath, savedDvp := socketPath, dvp
+	socketPath = filepath.Join(dir, "plugin.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: plugin}
+	go server.Serve(listener)
+	dvp, err = dockervol.NewDockerVolumePlugin(&dockervol.Options{SocketPath: socketPath, SupportsCapabilities: plugin.scope != ""})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return func() {
+		server.Close()
+		socketPath, dvp = savedSocketPath, savedDvp
+	}
+}
+
+func TestGetDockerPathFromPlugin(t *testing.T) {
+	dir, err := ioutil.TempDir("", "plugin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	plugin := &testPlugin{paths: map[string]string{"vol1": "/no/such/mountpoint", "vol2": ""}}
+	stop := startTestPlugin(t, dir, plugin)
+	defer stop()
+
+	// the mountpoint isn't visible here, so the plugin is trusted
+	if path, err := getDockerPathFromPlugin("vol1", "/dev/sdb"); err != nil || path != "/no/such/mountpoint" {
+		t.Errorf("expected /no/such/mountpoint for vol1 got %s %v", path, err)
+	}
+	// not mounted
+	if path, err := getDockerPathFromPlugin("vol2", "/dev/sdb"); err != nil || path != "" {
+		t.Errorf("expected no path for vol2 got %s %v", path, err)
+	}
+	// unknown to the plugin
+	if path, err := getDockerPathFromPlugin("vol3", "/dev/sdb"); err != nil || path != "" {
+		t.Errorf("expected no path for vol3 got %s %v", path, err)
+	}
+
+	// a plugin that doesn't answer isn't taken to mean the volume isn't mounted
+	stop()
+	dvp, err = dockervol.NewDockerVolumePlugin(&dockervol.Options{SocketPath: filepath.Join(dir, "plugin.sock"), RetryPolicy: &util.RetryPolicy{MaxTries: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := getDockerPathFromPlugin("vol1", "/dev/sdb"); err == nil {
+		t.Error("expected an error without the plugin")
+	}
+}
@@ -0,0 +1,103 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/util"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	podsDir    = "pods"
+	volumesDir = "volumes"
+	//legacyPodPathRegex is what earlier versions accepted, it's used if none of the kubelet root directories match
+	//example: /var/lib/rancher/kubelet/pods/fb36bec9-51f7-11e7-8eb8-005056968cbc/volumes/hpe~nimble/test
+	legacyPodPathRegex = "^(?P<root>/var/lib/.*)/pods/[^/]*/volumes/[^/]*/[^/]*$"
+)
+
+var (
+	//DefaultKubeletRootDirs are the kubelet root directories (--root-dir) used by common distributions
+	DefaultKubeletRootDirs = []string{
+		"/var/lib/kubelet",
+		"/var/lib/origin/openshift.local.volumes",
+		"/var/snap/microk8s/common/var/lib/kubelet",
+		"/opt/kubelet",
+	}
+
+	//kubeletRootDirs are the candidate kubelet root directories for pod volume paths
+	kubeletRootDirs = DefaultKubeletRootDirs
+)
+
+//PodVolumePath is a pod's volume path split into its parts.  Pod volume paths look like
+// <kubelet root>/pods/<pod uid>/volumes/<vendor>~<driver>/<volume name>
+//for example
+// /var/lib/kubelet/pods/fb36bec9-51f7-11e7-8eb8-005056968cbc/volumes/hpe~nimble/test
+type PodVolumePath struct {
+	Path        string
+	KubeletRoot string
+	PodUID      string
+	//Driver is the escaped driver name, vendor~driver
+	Driver     string
+	VolumeName string
+}
+
+// parsePodVolumePath splits path using the longest matching kubelet root directory.  Paths under
+// /var/lib that aren't in any of them are still accepted, as they were before the roots were configurable.
+func parsePodVolumePath(path string) (*PodVolumePath, error) {
+	util.LogDebug.Printf("parsePodVolumePath called with %s", path)
+	path = filepath.Clean(path)
+	root := ""
+	for _, dir := range kubeletRootDirs {
+		dir = filepath.Clean(dir)
+		if strings.HasPrefix(path, dir+"/"+podsDir+"/") && len(dir) > len(root) {
+			root = dir
+		}
+	}
+	if root == "" {
+		match := regexp.MustCompile(legacyPodPathRegex).FindStringSubmatch(path)
+		if match == nil {
+			return nil, fmt.Errorf("%s is not in any of the kubelet root directories %v", path, kubeletRootDirs)
+		}
+		root = match[1]
+		util.LogInfo.Printf("%s is not in any of the kubelet root directories %v, using %s.  Add it to kubeletRootDirs.", path, kubeletRootDirs, root)
+	}
+
+	// <pod uid>/volumes/<vendor>~<driver>/<volume name>
+	parts := strings.Split(strings.TrimPrefix(path, root+"/"+podsDir+"/"), "/")
+	if len(parts) != 4 || parts[0] == "" || parts[1] != volumesDir || parts[2] == "" || parts[3] == "" {
+		return nil, fmt.Errorf("unable to split %s into pod uid, driver and volume name", path)
+	}
+
+	podPath := &PodVolumePath{
+		Path:        path,
+		KubeletRoot: root,
+		PodUID:      parts[0],
+		Driver:      parts[2],
+		VolumeName:  parts[3],
+	}
+	util.LogDebug.Printf("parsePodVolumePath returning %+v", podPath)
+	return podPath, nil
+}
+
+// getDeviceMountPath builds the global device mount path kubelet uses for the volume
+func (p *PodVolumePath) getDeviceMountPath(dockerVolName string) string {
+	driver := strings.Replace(p.Driver, "~", "/", 1)
+	return filepath.Join(p.KubeletRoot, flexvolPluginDir, driver, flexvolMountsDir, dockerVolName)
+}
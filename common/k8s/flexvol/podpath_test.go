@@ -0,0 +1,84 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"testing"
+)
+
+var podVolumePathTests = []struct {
+	path     string
+	expected PodVolumePath
+	err      bool
+}{
+	{"/var/lib/kubelet/pods/fb36bec9-51f7-11e7-8eb8-005056968cbc/volumes/hpe~nimble/test", PodVolumePath{KubeletRoot: "/var/lib/kubelet", PodUID: "fb36bec9-51f7-11e7-8eb8-005056968cbc", Driver: "hpe~nimble", VolumeName: "test"}, false},
+	{"/var/lib/origin/openshift.local.volumes/pods/88917cdb-514d-11e7-93fb-5254005e615a/volumes/hpe~nimble/test2", PodVolumePath{KubeletRoot: "/var/lib/origin/openshift.local.volumes", PodUID: "88917cdb-514d-11e7-93fb-5254005e615a", Driver: "hpe~nimble", VolumeName: "test2"}, false},
+	{"/var/snap/microk8s/common/var/lib/kubelet/pods/uid/volumes/dev.hpe.com~nimble/data/", PodVolumePath{KubeletRoot: "/var/snap/microk8s/common/var/lib/kubelet", PodUID: "uid", Driver: "dev.hpe.com~nimble", VolumeName: "data"}, false},
+	{"/opt/kubelet/pods/uid/volumes/hpe~nimble/data", PodVolumePath{KubeletRoot: "/opt/kubelet", PodUID: "uid", Driver: "hpe~nimble", VolumeName: "data"}, false},
+	{"/var/lib/rancher/kubelet/pods/uid/volumes/hpe~nimble/data", PodVolumePath{KubeletRoot: "/var/lib/rancher/kubelet", PodUID: "uid", Driver: "hpe~nimble", VolumeName: "data"}, false},
+	{"/data/kubelet/pods/uid/volumes/hpe~nimble/data", PodVolumePath{}, true},
+	{"/var/lib/rancher/kubelet/pods/uid/volumes/hpe~nimble", PodVolumePath{}, true},
+	{"/var/lib/kubelet/pods/uid/volumes/hpe~nimble", PodVolumePath{}, true},
+	{"/var/lib/kubelet/pods/uid/volume-subpaths/hpe~nimble/data", PodVolumePath{}, true},
+}
+
+func TestParsePodVolumePath(t *testing.T) {
+	for _, tc := range podVolumePathTests {
+		t.Run(tc.path, func(t *testing.T) {
+			path, err := parsePodVolumePath(tc.path)
+			if (err != nil) != tc.err {
+				t.Fatal(
+					"For", "err",
+					"expected", tc.err,
+					"got", err,
+				)
+			}
+			if err != nil {
+				return
+			}
+			tc.expected.Path = path.Path
+			if *path != tc.expected {
+				t.Error(
+					"For", tc.path,
+					"expected", tc.expected,
+					"got", *path,
+				)
+			}
+		})
+	}
+}
+
+func TestParsePodVolumePathCustomRoot(t *testing.T) {
+	saved := kubeletRootDirs
+	kubeletRootDirs = []string{"/data", "/data/kubelet"}
+	defer func() { kubeletRootDirs = saved }()
+
+	path, err := parsePodVolumePath("/data/kubelet/pods/uid/volumes/hpe~nimble/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.KubeletRoot != "/data/kubelet" || path.PodUID != "uid" {
+		t.Error("expected root /data/kubelet got", path)
+	}
+	if _, err = parsePodVolumePath("/opt/kubelet/pods/uid/volumes/hpe~nimble/data"); err == nil {
+		t.Error("expected the default roots to be replaced")
+	}
+	// paths under /var/lib are accepted as they were before the roots were configurable
+	if path, err = parsePodVolumePath("/var/lib/kubelet/pods/uid/volumes/hpe~nimble/data"); err != nil || path.KubeletRoot != "/var/lib/kubelet" {
+		t.Error("expected root /var/lib/kubelet got", path, err)
+	}
+}
@@ -0,0 +1,38 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import "github.com/hpe-storage/dory/common/docker/dockervol"
+
+const (
+	//nodeOption is set by doryd when the plugin's volumes are local to a node, it's removed before the volume is created
+	nodeOption = "node"
+)
+
+// checkNode returns an error if the plugin's volumes are local to a node and the volume was created
+// on another node.  Creating it here would give the pod a new, empty volume.
+func checkNode(name string, options map[string]interface{}) error {
+	node, _ := options[nodeOption].(string)
+	if node == "" || dvp.Scope() != dockervol.ScopeLocal {
+		return nil
+	}
+	if !isLocalNode(node) {
+		hostname, _ := getHostname()
+		return newError(ErrorCodeWrongNode, "volume %s is local to node %s and can't be created on %s", name, node, hostname)
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestCheckNode(t *testing.T) {
+	savedGetHostname := getHostname
+	defer func() { getHostname = savedGetHostname }()
+	getHostname = func() (string, error) { return "node1", nil }
+
+	for _, scope := range []string{dockervol.ScopeLocal, dockervol.ScopeGlobal} {
+		dir, err := ioutil.TempDir("", "scope")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dir)
+		stop := startTestPlugin(t, dir, &testPlugin{scope: scope})
+
+		tests := []struct {
+			options map[string]interface{}
+			wrong   bool
+		}{
+			{map[string]interface{}{}, false},
+			{map[string]interface{}{nodeOption: "node1"}, false},
+			{map[string]interface{}{nodeOption: "NODE1"}, false},
+			{map[string]interface{}{nodeOption: "node1.example.com"}, false},
+			{map[string]interface{}{nodeOption: "node2"}, scope == dockervol.ScopeLocal},
+		}
+		for _, tc := range tests {
+			err = checkNode("vol1", tc.options)
+			if tc.wrong && GetErrorCode(err) != ErrorCodeWrongNode {
+				t.Errorf("%s scope with %v expected %s got %v", scope, tc.options, ErrorCodeWrongNode, err)
+			}
+			if !tc.wrong && err != nil {
+				t.Errorf("%s scope with %v expected no error got %s", scope, tc.options, err.Error())
+			}
+		}
+		stop()
+	}
+}
@@ -0,0 +1,111 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"github.com/hpe-storage/dory/common/linux"
+	"github.com/hpe-storage/dory/common/util"
+	"strings"
+)
+
+// Set selinux context if configured
+// References:
+//    https://github.com/kubernetes/kubernetes/issues/20813
+//    https://github.com/openshift/origin/issues/741
+//    https://github.com/projectatomic/atomic-site/blob/master/source/blog/2015-06-15-using-volumes-with-docker-can-cause-problems-with-selinux.html.md
+
+const (
+	//SelinuxLabelChcon labels the volume with chcon after it's mounted
+	SelinuxLabelChcon = "chcon"
+	//SelinuxLabelContext labels the volume with the context= mount option when the device is mounted
+	SelinuxLabelContext = "context"
+	//SelinuxLabelNone leaves the volume's labels alone
+	SelinuxLabelNone = "none"
+	//DefaultSelinuxType is the type volumes are labeled with
+	DefaultSelinuxType = "svirt_sandbox_file_t"
+
+	//per volume options, these are removed before the volume is created
+	selinuxLabelOption = "selinuxLabel"
+	selinuxTypeOption  = "selinuxType"
+	selinuxLevelOption = "selinuxLevel"
+)
+
+var (
+	//selinuxLabel is one of chcon, context or none
+	selinuxLabel = SelinuxLabelChcon
+
+	//selinuxType is the selinux type volumes are labeled with
+	selinuxType = DefaultSelinuxType
+
+	//selinuxLevel is the selinux (MCS) level volumes are labeled with, empty leaves it alone
+	selinuxLevel = ""
+)
+
+//selinuxLabeling is the labeling that applies to a volume
+type selinuxLabeling struct {
+	label   string
+	seType  string
+	seLevel string
+}
+
+// getSelinuxLabeling returns the driver's labeling overridden by any per volume options
+func (ar *AttachRequest) getSelinuxLabeling() *selinuxLabeling {
+	labeling := &selinuxLabeling{label: selinuxLabel, seType: selinuxType, seLevel: selinuxLevel}
+	if ar.SelinuxLabel != "" {
+		labeling.label = strings.ToLower(ar.SelinuxLabel)
+	}
+	if ar.SelinuxType != "" {
+		labeling.seType = ar.SelinuxType
+	}
+	if ar.SelinuxLevel != "" {
+		labeling.seLevel = ar.SelinuxLevel
+	}
+	return labeling
+}
+
+// getDeviceMountOptions adds the context= option to the mount options when the volume is labeled at mount time
+func (ar *AttachRequest) getDeviceMountOptions() []string {
+	options := ar.getMountOptions()
+	labeling := ar.getSelinuxLabeling()
+	if labeling.label == SelinuxLabelContext && linux.SelinuxEnabled() {
+		options = append(options, linux.GetContextMountOption(labeling.seType, labeling.seLevel))
+	}
+	return options
+}
+
+// applySelinuxLabel labels the volume mounted at path.  Volumes labeled by the context= mount option
+// only need chcon when they were bind mounted since the option can't be applied to a bind mount.
+func applySelinuxLabel(path string, req *AttachRequest, bind bool) error {
+	labeling := req.getSelinuxLabeling()
+	switch labeling.label {
+	case SelinuxLabelNone:
+		return nil
+	case SelinuxLabelContext:
+		if !bind {
+			return nil
+		}
+		util.LogInfo.Printf("%s is a bind mount, using chcon instead of the context mount option", path)
+	}
+	return linux.ChconWithLevel(labeling.seType, labeling.seLevel, path)
+}
+
+// removeSelinuxOptions removes the per volume labeling options so they aren't passed to the plugin
+func removeSelinuxOptions(options map[string]interface{}) {
+	for _, option := range []string{selinuxLabelOption, selinuxTypeOption, selinuxLevelOption} {
+		delete(options, option)
+	}
+}
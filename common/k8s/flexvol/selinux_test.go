@@ -0,0 +1,51 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package flexvol
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestGetSelinuxLabeling(t *testing.T) {
+	selinuxLabel = SelinuxLabelChcon
+	selinuxType = DefaultSelinuxType
+	selinuxLevel = ""
+
+	req := &AttachRequest{}
+	labeling := req.getSelinuxLabeling()
+	if labeling.label != SelinuxLabelChcon || labeling.seType != DefaultSelinuxType || labeling.seLevel != "" {
+		t.Error("expected the driver labeling, got", labeling)
+	}
+
+	err := json.Unmarshal([]byte(`{"kubernetes.io/fsType":"xfs","selinuxLabel":"Context","selinuxType":"container_file_t","selinuxLevel":"s0:c1,c2"}`), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	labeling = req.getSelinuxLabeling()
+	if labeling.label != SelinuxLabelContext || labeling.seType != "container_file_t" || labeling.seLevel != "s0:c1,c2" {
+		t.Error("expected the volume labeling, got", labeling)
+	}
+}
+
+func TestRemoveSelinuxOptions(t *testing.T) {
+	options := map[string]interface{}{"size": "10", "selinuxLabel": "none", "selinuxType": "container_file_t", "selinuxLevel": "s0"}
+	removeSelinuxOptions(options)
+	if len(options) != 1 || options["size"] != "10" {
+		t.Error("expected only size to remain, got", options)
+	}
+}
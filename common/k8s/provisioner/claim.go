@@ -94,6 +94,7 @@ func (p *Provisioner) updatedClaim(oldT interface{}, newT interface{}) {
 	}
 	util.LogDebug.Printf("updatedClaim: pvc %s current phase=%s", claim.Name, claim.Status.Phase)
 	go p.sendUpdate(claim)
+	go p.processResizedClaim(claim)
 }
 
 func getClaimClassName(claim *api_v1.PersistentVolumeClaim) (name string) {
@@ -35,6 +35,7 @@ import (
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
 	"math/rand"
+	"os"
 	"reflect"
 	"strings"
 	"sync"
@@ -61,8 +62,21 @@ const (
 	cloneOfPVC                 = "cloneOfPVC"
 	manager                    = "manager"
 	managerName                = "k8s"
+	secretName                 = "secretName"
 	id2chanMapSize             = 1024
 	deleteRetrySleep           = 5 * time.Second
+	//supportsCapabilities is the driver config option that tells whether the plugin reports its scope
+	supportsCapabilities = "supportsCapabilities"
+	//nodeOption tells the flexvolume driver which node a volume with local scope was created on
+	nodeOption = "node"
+	//hostnameLabel is the node label used to pin volumes with local scope to their node
+	hostnameLabel = "kubernetes.io/hostname"
+	//caFile, certFile and keyFile are the driver config options for a tcp:// or https:// plugin address
+	caFile   = "dockerVolumePluginCAFile"
+	certFile = "dockerVolumePluginCertFile"
+	keyFile  = "dockerVolumePluginKeyFile"
+	//nodeNameEnv is set to the name of the node running doryd, the hostname is used if it isn't set
+	nodeNameEnv = "NODE_NAME"
 )
 
 var (
@@ -92,8 +106,14 @@ type Provisioner struct {
 	eventRecorder           record.EventRecorder
 	provisionCommandChains  uint32
 	deleteCommandChains     uint32
+	resizeCommandChains     uint32
 	parkedCommands          uint32
 	debug                   bool
+	// resizing tracks the claims with a resize in progress
+	resizing   map[string]bool
+	resizeLock *sync.Mutex
+	// nodeName is where doryd creates volumes, volumes with local scope are pinned to it
+	nodeName string
 }
 
 type updateMessage struct {
@@ -202,9 +222,25 @@ func NewProvisioner(clientSet *kubernetes.Clientset, provisionerName string, aff
 		dockerVolNameAnnotation: provisionerName + "/" + dockerVolumeName,
 		eventRecorder:           broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: fmt.Sprintf("%s-%s", provisionerName, id.String())}),
 		debug:                   debug,
+		resizing:                make(map[string]bool),
+		resizeLock:              &sync.Mutex{},
+		nodeName:                getNodeName(),
 	}
 }
 
+// getNodeName returns the name of the node doryd is running on
+func getNodeName() string {
+	if nodeName := os.Getenv(nodeNameEnv); nodeName != "" {
+		return nodeName
+	}
+	hostname, err := os.Hostname()
+	if err != nil {
+		util.LogError.Printf("unable to get the node name from %s or the hostname - %s", nodeNameEnv, err.Error())
+		return ""
+	}
+	return hostname
+}
+
 // update the existing volume's metadata for the claims
 func (p *Provisioner) updateDockerVolumeMetadata(store cache.Store) {
 	util.LogDebug.Print("updateDockerVolumeMetadata started")
@@ -396,6 +432,10 @@ func (p *Provisioner) provisionVolume(claim *api_v1.PersistentVolumeClaim, class
 	// create a copy of the storage class options for NLT-1172
 	params := make(map[string]string)
 	for key, value := range class.Parameters {
+		// the secret is referenced by the pv, not passed as an option
+		if key == secretName {
+			continue
+		}
 		params[key] = value
 	}
 	// add name to options
@@ -452,6 +492,27 @@ func (p *Provisioner) provisionVolume(claim *api_v1.PersistentVolumeClaim, class
 
 	// set default docker options if not already set
 	p.setDefaultDockerOptions(optionsMap, params, dockerOptions, dockerClient)
+
+	// FlexVolume isn't a block volume plugin, kubelet won't use a flexvolume pv with volumeMode Block
+	if isBlockClaim(claim) {
+		util.LogError.Printf("unable to provision block pvc %s (%s), flexvolume pvs can't have volumeMode %s", claim.Name, id, api_v1.PersistentVolumeBlock)
+		p.eventRecorder.Event(class, api_v1.EventTypeWarning, "ProvisionStorage",
+			fmt.Sprintf("failed to create block volume for claim %s with class %s: flexvolume drivers don't support volumeMode %s", claim.Name, class.Name, api_v1.PersistentVolumeBlock))
+		return
+	}
+
+	// volumes of a plugin with local scope only exist on the node they're created on
+	if p.affectDockerVols && dockerClient.Scope() == dockervol.ScopeLocal {
+		if p.nodeName == "" {
+			util.LogError.Printf("unable to provision pvc %s (%s), %s has local scope and the node name isn't known", claim.Name, id, class.Provisioner)
+			p.eventRecorder.Event(class, api_v1.EventTypeWarning, "ProvisionStorage",
+				fmt.Sprintf("failed to create volume for claim %s with class %s: %s has local scope and %s isn't set", claim.Name, class.Name, class.Provisioner, nodeNameEnv))
+			return
+		}
+		pv.Spec.NodeAffinity = newNodeAffinity(p.nodeName)
+		pv.Spec.PersistentVolumeSource.FlexVolume.Options[nodeOption] = p.nodeName
+	}
+
 	if p.affectDockerVols {
 		provisionChain.AppendRunner(&createDockerVol{
 			requestedName: pv.Name,
@@ -536,7 +597,7 @@ func (p *Provisioner) newDockerVolumePluginClient(provisionerName string) (*dock
 		util.LogInfo.Printf("Unable to parse provisioner name %s.", provisionerName)
 		return nil, nil, fmt.Errorf("unable to parse provisioner name %s", provisionerName)
 	}
-	configPathName := fmt.Sprintf("%s%s/%s.json", flexVolumeBasePath, strings.Replace(provisionerName, "/", "~", 1), driverName[1])
+	configPathName := getDriverConfigPath(provisionerName)
 	util.LogDebug.Printf("looking for %s", configPathName)
 	var (
 		socketFile                   = defaultSocketFile
@@ -544,6 +605,8 @@ func (p *Provisioner) newDockerVolumePluginClient(provisionerName string) (*dock
 		listOfStorageResourceOptions = defaultListOfStorageResourceOptions
 		factorForConversion          = defaultfactorForConversion
 		dockerOpts                   = defaultDockerOptions
+		capabilities                 = true
+		tlsConfig                    *dockervol.TLSConfig
 	)
 	c, err := jconfig.NewConfig(configPathName)
 	if err != nil {
@@ -561,6 +624,11 @@ func (p *Provisioner) newDockerVolumePluginClient(provisionerName string) (*dock
 		if err != nil {
 			listOfStorageResourceOptions = ss
 		}
+		b, err = c.GetBool(supportsCapabilities)
+		if err == nil {
+			capabilities = b
+		}
+		tlsConfig = getTLSConfig(c)
 		i := c.GetInt64("factorForConversion")
 		if i != 0 {
 			factorForConversion = int(i)
@@ -585,11 +653,52 @@ func (p *Provisioner) newDockerVolumePluginClient(provisionerName string) (*dock
 		StripK8sFromOptions:          strip,
 		ListOfStorageResourceOptions: listOfStorageResourceOptions,
 		FactorForConversion:          factorForConversion,
+		SupportsCapabilities:         capabilities,
+		TLSConfig:                    tlsConfig,
 	}
 	client, er := dockervol.NewDockerVolumePlugin(options)
 	return client, dockerOpts, er
 }
 
+// getDriverConfigPath returns the path of the flexvolume driver's config for a provisioner named vendor/driver
+func getDriverConfigPath(provisionerName string) string {
+	driverName := strings.Split(provisionerName, "/")
+	return fmt.Sprintf("%s%s/%s.json", flexVolumeBasePath, strings.Replace(provisionerName, "/", "~", 1), driverName[len(driverName)-1])
+}
+
+// getTLSConfig returns the tls config for the plugin address in the driver config, nil if it doesn't have one
+func getTLSConfig(c *jconfig.Config) *dockervol.TLSConfig {
+	tlsConfig := &dockervol.TLSConfig{
+		CAFile:   c.GetString(caFile),
+		CertFile: c.GetString(certFile),
+		KeyFile:  c.GetString(keyFile),
+	}
+	if tlsConfig.CAFile == "" && tlsConfig.CertFile == "" && tlsConfig.KeyFile == "" {
+		return nil
+	}
+	return tlsConfig
+}
+
+// newNodeAffinity requires the node with the hostname label nodeName
+func newNodeAffinity(nodeName string) *api_v1.VolumeNodeAffinity {
+	return &api_v1.VolumeNodeAffinity{
+		Required: &api_v1.NodeSelector{
+			NodeSelectorTerms: []api_v1.NodeSelectorTerm{{
+				MatchExpressions: []api_v1.NodeSelectorRequirement{{
+					Key:      hostnameLabel,
+					Operator: api_v1.NodeSelectorOpIn,
+					Values:   []string{nodeName},
+				}},
+			}},
+		},
+	}
+}
+
+// isBlockClaim returns true if the claim is for a raw block volume
+func isBlockClaim(claim *api_v1.PersistentVolumeClaim) bool {
+	return claim.Spec.VolumeMode != nil && *claim.Spec.VolumeMode == api_v1.PersistentVolumeBlock
+}
+
 // block until there are some classes defined in the cluster
 func (p *Provisioner) waitForClasses() {
 	i := 0
@@ -3,12 +3,15 @@ package provisioner
 import (
 	"fmt"
 	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"github.com/hpe-storage/dory/common/jconfig"
+	"io/ioutil"
 	api_v1 "k8s.io/api/core/v1"
 	storage_v1 "k8s.io/api/storage/v1"
 	resource_v1 "k8s.io/apimachinery/pkg/api/resource"
 	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	rest "k8s.io/client-go/rest"
+	"os"
 	"testing"
 )
 
@@ -143,6 +146,16 @@ func TestGetPersistentVolume(t *testing.T) {
 	if vol == nil {
 		t.Error("unable to retrieve volume from pv interface")
 	}
+	if vol.Spec.FlexVolume.SecretRef != nil {
+		t.Error("unexpected secret reference", vol.Spec.FlexVolume.SecretRef)
+	}
+
+	class := getTestStorageClass()
+	class.Parameters[secretName] = "array-token"
+	pv, _ = p.newPersistentVolume("pv-test", getStorageClassParams(), getTestPVC(), class)
+	if pv.Spec.FlexVolume.SecretRef == nil || pv.Spec.FlexVolume.SecretRef.Name != "array-token" {
+		t.Error("expected secret reference array-token got", pv.Spec.FlexVolume.SecretRef)
+	}
 }
 
 func TestGetPersistentVolumeClaim(t *testing.T) {
@@ -206,3 +219,74 @@ func TestOverrides(t *testing.T) {
 	fmt.Print(overrides)
 
 }
+
+func TestSetClaimResizePending(t *testing.T) {
+	conditions := []api_v1.PersistentVolumeClaimCondition{{Type: claimResizing, Status: api_v1.ConditionTrue}}
+	conditions = setClaimResizePending(conditions)
+	if len(conditions) != 1 || conditions[0].Type != claimFileSystemResizePending {
+		t.Error("expected only the FileSystemResizePending condition, got", conditions)
+	}
+
+	conditions = setClaimResizePending(conditions)
+	if len(conditions) != 1 {
+		t.Error("expected FileSystemResizePending to be set once, got", conditions)
+	}
+}
+
+func TestIsBlockClaim(t *testing.T) {
+	claim := getTestPVC()
+	if isBlockClaim(claim) {
+		t.Error("expected a claim without a volume mode not to be block")
+	}
+	mode := api_v1.PersistentVolumeBlock
+	claim.Spec.VolumeMode = &mode
+	if !isBlockClaim(claim) {
+		t.Error("expected a claim with volume mode Block to be block")
+	}
+}
+
+func TestGetDriverConfigPath(t *testing.T) {
+	path := getDriverConfigPath("hpe.com/nimble")
+	if path != flexVolumeBasePath+"hpe.com~nimble/nimble.json" {
+		t.Error("unexpected driver config path", path)
+	}
+}
+
+func TestNewNodeAffinity(t *testing.T) {
+	affinity := newNodeAffinity("node1")
+	terms := affinity.Required.NodeSelectorTerms
+	if len(terms) != 1 || len(terms[0].MatchExpressions) != 1 {
+		t.Fatal("expected a single node selector requirement, got", terms)
+	}
+	requirement := terms[0].MatchExpressions[0]
+	if requirement.Key != hostnameLabel || requirement.Operator != api_v1.NodeSelectorOpIn || len(requirement.Values) != 1 || requirement.Values[0] != "node1" {
+		t.Error("unexpected node selector requirement", requirement)
+	}
+}
+
+func TestGetTLSConfig(t *testing.T) {
+	file, err := ioutil.TempFile("", "nimble.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	file.WriteString(`{"dockerVolumePluginSocketPath": "https://plugin.example.com", "dockerVolumePluginCAFile": "/etc/dory/ca.pem"}`)
+	file.Close()
+
+	c, err := jconfig.NewConfig(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConfig := getTLSConfig(c)
+	if tlsConfig == nil || tlsConfig.CAFile != "/etc/dory/ca.pem" || tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
+		t.Error("unexpected tls config", tlsConfig)
+	}
+
+	c, err = jconfig.NewConfig("../../../cmd/dory/dory.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tlsConfig = getTLSConfig(c); tlsConfig != nil {
+		t.Error("expected no tls config, got", tlsConfig)
+	}
+}
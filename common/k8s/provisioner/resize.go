@@ -0,0 +1,251 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package provisioner
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/chain"
+	"github.com/hpe-storage/dory/common/docker/dockervol"
+	"github.com/hpe-storage/dory/common/util"
+	api_v1 "k8s.io/api/core/v1"
+	resource_v1 "k8s.io/apimachinery/pkg/api/resource"
+	meta_v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	// claimFileSystemResizePending tells the kubelet to expand the filesystem the next time the volume is mounted
+	claimFileSystemResizePending = api_v1.PersistentVolumeClaimConditionType("FileSystemResizePending")
+	// claimResizing indicates the volume is being resized on the backend
+	claimResizing = api_v1.PersistentVolumeClaimConditionType("Resizing")
+	//TODO allow this to be set per docker volume driver
+	maxResizes = 4
+)
+
+// processResizedClaim expands the docker volume and pv when the storage requested by a bound claim
+// grows beyond the capacity of its pv.  The claim is then marked FileSystemResizePending so the
+// kubelet will call expandfs the next time the volume is mounted.
+func (p *Provisioner) processResizedClaim(claim *api_v1.PersistentVolumeClaim) {
+	if claim.Status.Phase != api_v1.ClaimBound || claim.Spec.VolumeName == "" {
+		return
+	}
+	requested, found := claim.Spec.Resources.Requests[api_v1.ResourceStorage]
+	if !found {
+		return
+	}
+
+	className := getClaimClassName(claim)
+	class, err := p.getClass(className)
+	if err != nil {
+		util.LogDebug.Printf("processResizedClaim: unable to get class named %s for pvc %s - skipping", className, claim.Name)
+		return
+	}
+	if !strings.HasPrefix(class.Provisioner, p.namePrefix) {
+		return
+	}
+
+	vol, err := p.kubeClient.Core().PersistentVolumes().Get(claim.Spec.VolumeName, meta_v1.GetOptions{})
+	if err != nil {
+		util.LogError.Printf("processResizedClaim: unable to get pv %s for pvc %s - %s", claim.Spec.VolumeName, claim.Name, err.Error())
+		return
+	}
+	capacity := vol.Spec.Capacity[api_v1.ResourceStorage]
+	if requested.Cmp(capacity) <= 0 {
+		return
+	}
+	if !strings.HasPrefix(vol.Annotations[k8sProvisionedBy], p.namePrefix) {
+		util.LogInfo.Printf("processResizedClaim: pv %s was not provisioned by %s - skipping", vol.Name, p.namePrefix)
+		return
+	}
+	if class.AllowVolumeExpansion == nil || !*class.AllowVolumeExpansion {
+		info := fmt.Sprintf("pvc %s requested %s but class %s doesn't allow volume expansion", claim.Name, requested.String(), class.Name)
+		util.LogInfo.Print(info)
+		p.eventRecorder.Event(claim, api_v1.EventTypeWarning, "ResizeVolume", info)
+		return
+	}
+
+	// only one resize per claim at a time, updates arrive on every resync
+	id := fmt.Sprintf("%s", claim.UID)
+	if !p.startResize(id) {
+		util.LogDebug.Printf("processResizedClaim: pvc %s is already being resized", claim.Name)
+		return
+	}
+	defer p.endResize(id)
+
+	p.resizeVolume(claim, class.Provisioner, vol, requested)
+}
+
+func (p *Provisioner) resizeVolume(claim *api_v1.PersistentVolumeClaim, provisioner string, vol *api_v1.PersistentVolume, requested resource_v1.Quantity) {
+	capacity := vol.Spec.Capacity[api_v1.ResourceStorage]
+	util.LogInfo.Printf("resizeVolume: pvc %s requested %s, pv %s capacity is %s", claim.Name, requested.String(), vol.Name, capacity.String())
+
+	// slow down a resize storm
+	limit(&p.resizeCommandChains, &p.parkedCommands, maxResizes)
+	atomic.AddUint32(&p.resizeCommandChains, 1)
+	defer atomic.AddUint32(&p.resizeCommandChains, ^uint32(0))
+
+	resizeChain := chain.NewChain(chainRetries, deleteRetrySleep)
+
+	if p.affectDockerVols {
+		dockerClient, _, err := p.newDockerVolumePluginClient(provisioner)
+		if err != nil {
+			info := fmt.Sprintf("failed to get docker client for %s while trying to resize pv %s: %v", provisioner, vol.Name, err)
+			util.LogError.Print(info)
+			p.eventRecorder.Event(claim, api_v1.EventTypeWarning, "ResizeVolumeGetClient", info)
+			return
+		}
+		resizeChain.AppendRunner(&expandDockerVol{
+			name:   vol.Name,
+			size:   requested.Value(),
+			client: dockerClient,
+		})
+	}
+
+	resizeChain.AppendRunner(&updatePersistentVolumeCapacity{
+		kubeClient: p.kubeClient,
+		name:       vol.Name,
+		capacity:   requested,
+	})
+
+	resizeChain.AppendRunner(&updateClaimResizeStatus{
+		kubeClient: p.kubeClient,
+		claim:      claim,
+	})
+
+	p.eventRecorder.Event(claim, api_v1.EventTypeNormal, "ResizeVolume", fmt.Sprintf("%s resizing pv %s to %s", provisioner, vol.Name, requested.String()))
+	err := resizeChain.Execute()
+	if err != nil {
+		p.eventRecorder.Event(claim, api_v1.EventTypeWarning, "ResizeVolume",
+			fmt.Sprintf("failed to resize pv %s to %s: %s", vol.Name, requested.String(), err))
+	}
+}
+
+func (p *Provisioner) startResize(id string) bool {
+	p.resizeLock.Lock()
+	defer p.resizeLock.Unlock()
+
+	if p.resizing[id] {
+		return false
+	}
+	p.resizing[id] = true
+	return true
+}
+
+func (p *Provisioner) endResize(id string) {
+	p.resizeLock.Lock()
+	defer p.resizeLock.Unlock()
+
+	delete(p.resizing, id)
+}
+
+type expandDockerVol struct {
+	name   string
+	size   int64
+	client *dockervol.DockerVolumePlugin
+}
+
+func (e expandDockerVol) Name() string {
+	return reflect.TypeOf(e).Name()
+}
+
+func (e *expandDockerVol) Run() (name interface{}, err error) {
+	name, err = e.client.Expand(e.name, e.size)
+	if err != nil {
+		util.LogError.Printf("failed to expand docker volume %s, error = %s", e.name, err.Error())
+		return nil, err
+	}
+	return name, nil
+}
+
+func (e *expandDockerVol) Rollback() (err error) {
+	// volumes can't be shrunk
+	return nil
+}
+
+type updatePersistentVolumeCapacity struct {
+	kubeClient *kubernetes.Clientset
+	name       string
+	capacity   resource_v1.Quantity
+}
+
+func (u updatePersistentVolumeCapacity) Name() string {
+	return reflect.TypeOf(u).Name()
+}
+
+func (u *updatePersistentVolumeCapacity) Run() (name interface{}, err error) {
+	// get the latest version of the pv on each try
+	vol, err := u.kubeClient.Core().PersistentVolumes().Get(u.name, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if vol.Spec.Capacity == nil {
+		vol.Spec.Capacity = make(api_v1.ResourceList)
+	}
+	vol.Spec.Capacity[api_v1.ResourceStorage] = u.capacity
+	return u.kubeClient.Core().PersistentVolumes().Update(vol)
+}
+
+func (u *updatePersistentVolumeCapacity) Rollback() (err error) {
+	//no op
+	return nil
+}
+
+type updateClaimResizeStatus struct {
+	kubeClient *kubernetes.Clientset
+	claim      *api_v1.PersistentVolumeClaim
+}
+
+func (u updateClaimResizeStatus) Name() string {
+	return reflect.TypeOf(u).Name()
+}
+
+func (u *updateClaimResizeStatus) Run() (name interface{}, err error) {
+	claim, err := u.kubeClient.Core().PersistentVolumeClaims(u.claim.Namespace).Get(u.claim.Name, meta_v1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	claim.Status.Conditions = setClaimResizePending(claim.Status.Conditions)
+	return u.kubeClient.Core().PersistentVolumeClaims(claim.Namespace).UpdateStatus(claim)
+}
+
+func (u *updateClaimResizeStatus) Rollback() (err error) {
+	//no op
+	return nil
+}
+
+// setClaimResizePending replaces any resize conditions with FileSystemResizePending
+func setClaimResizePending(conditions []api_v1.PersistentVolumeClaimCondition) []api_v1.PersistentVolumeClaimCondition {
+	var updated []api_v1.PersistentVolumeClaimCondition
+	for _, condition := range conditions {
+		if condition.Type == claimFileSystemResizePending {
+			// already waiting on the kubelet
+			return conditions
+		}
+		if condition.Type != claimResizing {
+			updated = append(updated, condition)
+		}
+	}
+	return append(updated, api_v1.PersistentVolumeClaimCondition{
+		Type:               claimFileSystemResizePending,
+		Status:             api_v1.ConditionTrue,
+		LastTransitionTime: meta_v1.Now(),
+		Message:            "Waiting for user to (re-)start a pod to finish file system resize of volume on node.",
+	})
+}
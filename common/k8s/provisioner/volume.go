@@ -208,6 +208,7 @@ func (p *Provisioner) newPersistentVolume(pvName string, params map[string]strin
 			AccessModes:                   claim.Spec.AccessModes,
 			ClaimRef:                      claimRef,
 			StorageClassName:              claimName,
+			MountOptions:                  class.MountOptions,
 			Capacity: api_v1.ResourceList{
 				api_v1.ResourceName(api_v1.ResourceStorage): claim.Spec.Resources.Requests[api_v1.ResourceName(api_v1.ResourceStorage)],
 			},
@@ -219,5 +220,8 @@ func (p *Provisioner) newPersistentVolume(pvName string, params map[string]strin
 			},
 		},
 	}
+	if class.Parameters[secretName] != "" {
+		pv.Spec.PersistentVolumeSource.FlexVolume.SecretRef = &api_v1.LocalObjectReference{Name: class.Parameters[secretName]}
+	}
 	return pv, nil
 }
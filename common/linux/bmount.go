@@ -17,6 +17,7 @@ limitations under the License.
 package linux
 
 import (
+	"github.com/hpe-storage/dory/common/model"
 	"github.com/hpe-storage/dory/common/util"
 	"strings"
 )
@@ -27,6 +28,14 @@ const (
 	umountCommand = "umount"
 )
 
+// bindRemountOptions are the per mount point options that can be applied to a bind mount
+var bindRemountOptions = map[string]bool{
+	"ro": true, "rw": true,
+	"atime": true, "noatime": true, "diratime": true, "nodiratime": true,
+	"relatime": true, "norelatime": true, "strictatime": true, "nostrictatime": true,
+	"dev": true, "nodev": true, "exec": true, "noexec": true, "suid": true, "nosuid": true,
+}
+
 func unmount(mountPoint string) error {
 	// try to unmount
 	args := []string{mountPoint}
@@ -37,9 +46,10 @@ func unmount(mountPoint string) error {
 	return nil
 }
 
-//BindMount mounts a path to a mountPoint.  The rbind flag controls recursive binding
-func BindMount(path, mountPoint string, rbind bool) error {
-	util.LogDebug.Printf("BindMount called with %s %s %v", path, mountPoint, rbind)
+//BindMount mounts a path to a mountPoint.  The rbind flag controls recursive binding.  Bind
+//mounts ignore options when they are created, so any options are applied by remounting.
+func BindMount(path, mountPoint string, rbind bool, options []string) error {
+	util.LogDebug.Printf("BindMount called with %s %s %v %v", path, mountPoint, rbind, options)
 	flag := "--bind"
 	if rbind {
 		flag = "--rbind"
@@ -52,9 +62,61 @@ func BindMount(path, mountPoint string, rbind bool) error {
 		return err
 	}
 
+	options = getBindRemountOptions(mountPoint, options)
+	if len(options) > 0 {
+		err = Remount(mountPoint, true, options)
+		if err != nil {
+			unmount(mountPoint)
+			return err
+		}
+	}
+
+	return nil
+}
+
+//Remount remounts mountPoint with the options provided.  Bind mounts must be remounted with
+//bind set in order for the options to take effect.
+func Remount(mountPoint string, bind bool, options []string) error {
+	util.LogDebug.Printf("Remount called with %s %v %v", mountPoint, bind, options)
+	opts := []string{"remount"}
+	if bind {
+		opts = append(opts, "bind")
+	}
+	opts = append(opts, options...)
+
+	args := []string{"-o", strings.Join(opts, ","), mountPoint}
+	out, rc, err := util.ExecCommandOutput(mountCommand, args)
+	if err != nil {
+		util.LogError.Printf("Remount failed with %d.  It was called with %s %v %v.  Output=%v.", rc, mountPoint, bind, options, out)
+		return err
+	}
+
 	return nil
 }
 
+//RemountReadOnly remounts mountPoint read only.
+func RemountReadOnly(mountPoint string, bind bool) error {
+	return Remount(mountPoint, bind, []string{"ro"})
+}
+
+// getBindRemountOptions returns the options that can change on a bind remount.  Filesystem
+// options like context= or nodiscard belong to the device mount and are dropped, which is logged
+// since the volume won't be mounted the way the PV asked.
+func getBindRemountOptions(mountPoint string, options []string) []string {
+	var bindOptions, dropped []string
+	for _, option := range options {
+		if bindRemountOptions[option] {
+			bindOptions = append(bindOptions, option)
+		} else {
+			dropped = append(dropped, option)
+		}
+	}
+	if len(dropped) > 0 {
+		util.LogInfo.Printf("mount options %v only apply to the device's mount and are ignored on the bind mount at %s", dropped, mountPoint)
+	}
+	return bindOptions
+}
+
 //BindUnmount unmounts a bind mount.
 func BindUnmount(mountPoint string) error {
 	util.LogDebug.Printf("BindUnmount called with %s", mountPoint)
@@ -82,6 +144,42 @@ func GetMountPointFromDevice(devPath string) (string, error) {
 	return getMountsEntry(devPath, true)
 }
 
+//GetMounts returns the mounts listed in /proc/mounts.
+func GetMounts() ([]*model.Mount, error) {
+	util.LogDebug.Print("GetMounts called")
+	mountLines, err := util.FileGetStrings(procMounts)
+	if err != nil {
+		return nil, err
+	}
+
+	var mounts []*model.Mount
+	for _, line := range mountLines {
+		entry := strings.Fields(line)
+		if len(entry) > 2 {
+			mounts = append(mounts, &model.Mount{
+				Mountpoint: entry[1],
+				Device:     &model.Device{Pathname: entry[0]},
+				FsType:     entry[2],
+			})
+		}
+	}
+	return mounts, nil
+}
+
+//GetMount returns the entry in /proc/mounts for mountPoint or nil if nothing is mounted there.
+func GetMount(mountPoint string) (*model.Mount, error) {
+	mounts, err := GetMounts()
+	if err != nil {
+		return nil, err
+	}
+	for _, mount := range mounts {
+		if mount.Mountpoint == mountPoint {
+			return mount, nil
+		}
+	}
+	return nil, nil
+}
+
 func getMountsEntry(path string, dev bool) (string, error) {
 	util.LogDebug.Printf("getMountsEntry called with path:%v isDev:%v", path, dev)
 	mountLines, err := util.FileGetStrings(procMounts)
@@ -17,6 +17,7 @@ limitations under the License.
 package linux
 
 import (
+	"strings"
 	"testing"
 )
 
@@ -88,3 +89,40 @@ func TestGetSilly(t *testing.T) {
 		)
 	}
 }
+
+var mountOptionTests = []struct {
+	name     string
+	options  []string
+	expected string
+}{
+	{"none", nil, ""},
+	{"bind", []string{"noatime", "nodev"}, "noatime,nodev"},
+	{"filesystem", []string{"context=\"system_u:object_r:svirt_sandbox_file_t:s0\"", "nodiscard"}, ""},
+	{"mixed", []string{"nodiscard", "ro", "nosuid"}, "ro,nosuid"},
+}
+
+func TestGetBindRemountOptions(t *testing.T) {
+	for _, tc := range mountOptionTests {
+		t.Run(tc.name, func(t *testing.T) {
+			options := strings.Join(getBindRemountOptions("/mnt/test", tc.options), ",")
+			if options != tc.expected {
+				t.Error(
+					"For", tc.options,
+					"expected", tc.expected,
+					"got", options,
+				)
+			}
+		})
+	}
+}
+
+func TestGetMountArgs(t *testing.T) {
+	args := getMountArgs("/dev/sdb", "/mnt", nil)
+	if strings.Join(args, " ") != "/dev/sdb /mnt" {
+		t.Error("For", "no options", "got", args)
+	}
+	args = getMountArgs("/dev/sdb", "/mnt", []string{"noatime", "nodiscard"})
+	if strings.Join(args, " ") != "-o noatime,nodiscard /dev/sdb /mnt" {
+		t.Error("For", "options", "got", args)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linux
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/util"
+	"strings"
+)
+
+const (
+	resize2fs    = "resize2fs"
+	xfsGrowfs    = "xfs_growfs"
+	btrfsCommand = "btrfs"
+)
+
+//ExpandFileSystem grows the filesystem mounted at mountPoint to fill its device.  The device
+//must already reflect the new size.
+func ExpandFileSystem(mountPoint string) error {
+	util.LogDebug.Printf("ExpandFileSystem called with %s", mountPoint)
+	mount, err := GetMount(mountPoint)
+	if err != nil {
+		return err
+	}
+	if mount == nil {
+		return fmt.Errorf("nothing is mounted at %s", mountPoint)
+	}
+
+	var cmd string
+	var args []string
+	switch {
+	case strings.HasPrefix(mount.FsType, "ext"):
+		cmd = resize2fs
+		args = []string{mount.Device.Pathname}
+	case mount.FsType == "xfs":
+		cmd = xfsGrowfs
+		args = []string{mountPoint}
+	case mount.FsType == "btrfs":
+		cmd = btrfsCommand
+		args = []string{"filesystem", "resize", "max", mountPoint}
+	default:
+		return fmt.Errorf("unable to expand %s filesystem mounted at %s", mount.FsType, mountPoint)
+	}
+
+	out, rc, err := util.ExecCommandOutput(cmd, args)
+	if err != nil {
+		util.LogError.Printf("ExpandFileSystem failed with %d.  %s was called with %v.  Output=%v.", rc, cmd, args, out)
+		return err
+	}
+	return nil
+}
@@ -22,15 +22,26 @@ import (
 	"github.com/hpe-storage/dory/common/model"
 	"github.com/hpe-storage/dory/common/util"
 	"strconv"
+	"strings"
 )
 
 const (
 	mountUUIDErr = 32
 )
 
-// MountDeviceWithFileSystem : Mount device with filesystem at the mountPoint
-func MountDeviceWithFileSystem(devPath string, mountPoint string) (*model.Mount, error) {
-	util.LogDebug.Printf("MountDeviceWithFileSystem called with %s %s", devPath, mountPoint)
+//MountedError is returned when a mount point already has something mounted on it
+type MountedError struct {
+	Device     string
+	MountPoint string
+}
+
+func (e *MountedError) Error() string {
+	return e.Device + " is already mounted at " + e.MountPoint
+}
+
+// MountDeviceWithFileSystem : Mount device with filesystem at the mountPoint using the options provided
+func MountDeviceWithFileSystem(devPath string, mountPoint string, options []string) (*model.Mount, error) {
+	util.LogDebug.Printf("MountDeviceWithFileSystem called with %s %s %v", devPath, mountPoint, options)
 	if devPath == "" || mountPoint == "" {
 		return nil, errors.New("Neither arg can be nul devPath :" + devPath + " mountPoint :" + mountPoint)
 	}
@@ -44,16 +55,15 @@ func MountDeviceWithFileSystem(devPath string, mountPoint string) (*model.Mount,
 	// check if mountpoint already has a device
 	mountedDevice, err := GetDeviceFromMountPoint(mountPoint)
 	if mountedDevice != "" || err != nil {
-		return nil, errors.New(devPath + " is already mounted at " + mountPoint)
+		return nil, &MountedError{Device: devPath, MountPoint: mountPoint}
 	}
 
 	// if not already mounted try to mount the device
-	args := []string{devPath, mountPoint}
-	_, rc, err := util.ExecCommandOutput(mountCommand, args)
+	_, rc, err := util.ExecCommandOutput(mountCommand, getMountArgs(devPath, mountPoint, options))
 	if err != nil {
 		if rc == mountUUIDErr {
 			util.LogDebug.Print("rc=" + strconv.Itoa(mountUUIDErr) + " trying again with no uuid option")
-			_, _, err = util.ExecCommandOutput(mountCommand, []string{"-o", "nouuid", devPath, mountPoint})
+			_, _, err = util.ExecCommandOutput(mountCommand, getMountArgs(devPath, mountPoint, append(options[:len(options):len(options)], "nouuid")))
 		}
 	}
 	if err != nil {
@@ -71,6 +81,13 @@ func MountDeviceWithFileSystem(devPath string, mountPoint string) (*model.Mount,
 	return mount, err
 }
 
+func getMountArgs(devPath, mountPoint string, options []string) []string {
+	if len(options) == 0 {
+		return []string{devPath, mountPoint}
+	}
+	return []string{"-o", strings.Join(options, ","), devPath, mountPoint}
+}
+
 func checkIfMountExists(devPath, mountPoint string) error {
 	is, _, err := util.FileExists(devPath)
 	if err != nil || is == false {
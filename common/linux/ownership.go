@@ -0,0 +1,86 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linux
+
+import (
+	"github.com/hpe-storage/dory/common/util"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	rwMask   = os.FileMode(0660)
+	execMask = os.FileMode(0110)
+)
+
+//SetVolumeOwnership recursively changes the group of path to gid and makes it group
+//read/write.  Directories also get the setgid bit so new files inherit the group.  This
+//mirrors what the kubelet does for in-tree volumes.  If onRootMismatch is true, the walk
+//is skipped when path already has the expected group and permissions.
+func SetVolumeOwnership(path string, gid int, onRootMismatch bool) error {
+	util.LogDebug.Printf("SetVolumeOwnership called with %s %d %v", path, gid, onRootMismatch)
+	if onRootMismatch {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if hasOwnership(info, gid) {
+			util.LogDebug.Printf("%s already has group %d, skipping ownership change", path, gid)
+			return nil
+		}
+	}
+
+	return filepath.Walk(path, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// symlinks are left alone, their targets may not be on this volume
+		if info.Mode()&os.ModeSymlink != 0 {
+			return nil
+		}
+
+		err = os.Lchown(name, -1, gid)
+		if err != nil {
+			util.LogError.Printf("unable to change group of %s to %d - %s", name, gid, err.Error())
+			return err
+		}
+
+		mask := rwMask
+		if info.IsDir() {
+			mask |= os.ModeSetgid | execMask
+		}
+		err = os.Chmod(name, info.Mode()|mask)
+		if err != nil {
+			util.LogError.Printf("unable to change mode of %s - %s", name, err.Error())
+			return err
+		}
+		return nil
+	})
+}
+
+func hasOwnership(info os.FileInfo, gid int) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || stat == nil || int(stat.Gid) != gid {
+		return false
+	}
+	mask := rwMask
+	if info.IsDir() {
+		mask |= os.ModeSetgid | execMask
+	}
+	return info.Mode()&mask == mask
+}
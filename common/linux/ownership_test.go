@@ -0,0 +1,75 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linux
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSetVolumeOwnership(t *testing.T) {
+	dir, err := ioutil.TempDir("", "ownership")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "sub")
+	if err = os.Mkdir(sub, 0700); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(sub, "file")
+	if err = ioutil.WriteFile(file, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	gid := os.Getgid()
+	if err = SetVolumeOwnership(dir, gid, false); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{dir, sub, file} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !hasOwnership(info, gid) {
+			t.Error(
+				"For", name,
+				"expected group", gid,
+				"got mode", info.Mode(),
+			)
+		}
+	}
+
+	// the root matches so the walk should be skipped
+	if err = os.Chmod(file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = SetVolumeOwnership(dir, gid, true); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Error("For", file, "expected mode", os.FileMode(0600), "got", info.Mode().Perm())
+	}
+}
@@ -0,0 +1,87 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linux
+
+import (
+	"fmt"
+	"github.com/hpe-storage/dory/common/util"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	procMountInfo = "/proc/self/mountinfo"
+	//PropagationShared - mount events propagate in both directions
+	PropagationShared = "shared"
+	//PropagationSlave - mount events only propagate into the mount
+	PropagationSlave = "slave"
+	//PropagationPrivate - mount events don't propagate
+	PropagationPrivate = "private"
+)
+
+//GetMountPropagation returns the propagation of the mount that contains path along with
+//its mount point.
+func GetMountPropagation(path string) (string, string, error) {
+	util.LogDebug.Printf("GetMountPropagation called with %s", path)
+	lines, err := util.FileGetStrings(procMountInfo)
+	if err != nil {
+		return "", "", err
+	}
+	return getMountPropagation(lines, path)
+}
+
+// getMountPropagation finds the longest mount point containing path in the mountinfo lines.
+// A mountinfo line looks like
+//   36 35 98:0 /mnt1 /mnt2 rw,noatime shared:1 master:2 - ext3 /dev/root rw
+// where the fields between the mount options and the "-" are optional.
+func getMountPropagation(lines []string, path string) (string, string, error) {
+	path = filepath.Clean(path)
+	mountPoint := ""
+	propagation := ""
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) < 7 {
+			continue
+		}
+		mp := strings.Replace(fields[4], "\\040", " ", -1)
+		if mp != "/" && path != mp && !strings.HasPrefix(path, mp+"/") {
+			continue
+		}
+		// later entries over the same mount point win since they're mounted on top
+		if len(mp) < len(mountPoint) {
+			continue
+		}
+		mountPoint = mp
+		propagation = PropagationPrivate
+		for _, field := range fields[6:] {
+			if field == "-" {
+				break
+			}
+			if strings.HasPrefix(field, "shared:") {
+				propagation = PropagationShared
+				break
+			}
+			if strings.HasPrefix(field, "master:") {
+				propagation = PropagationSlave
+			}
+		}
+	}
+	if mountPoint == "" {
+		return "", "", fmt.Errorf("unable to find the mount containing %s", path)
+	}
+	return propagation, mountPoint, nil
+}
@@ -0,0 +1,63 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linux
+
+import (
+	"testing"
+)
+
+var mountInfo = []string{
+	"22 1 253:0 / / rw,relatime shared:1 - xfs /dev/mapper/root rw",
+	"40 22 253:2 / /var/lib rw,relatime master:7 - xfs /dev/mapper/varlib rw",
+	"41 40 253:3 / /var/lib/kubelet rw,relatime - xfs /dev/mapper/kubelet rw",
+	"42 22 0:40 / /mnt/my\\040disk rw,relatime shared:9 - tmpfs tmpfs rw",
+}
+
+var propagationTests = []struct {
+	path        string
+	propagation string
+	mountPoint  string
+}{
+	{"/usr/bin", PropagationShared, "/"},
+	{"/var/lib/docker", PropagationSlave, "/var/lib"},
+	{"/var/lib/kubelet/pods", PropagationPrivate, "/var/lib/kubelet"},
+	{"/var/lib/kubelet", PropagationPrivate, "/var/lib/kubelet"},
+	{"/var/lib/kubeletx", PropagationSlave, "/var/lib"},
+	{"/mnt/my disk/data", PropagationShared, "/mnt/my disk"},
+}
+
+func TestGetMountPropagation(t *testing.T) {
+	for _, tc := range propagationTests {
+		t.Run(tc.path, func(t *testing.T) {
+			propagation, mountPoint, err := getMountPropagation(mountInfo, tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if propagation != tc.propagation || mountPoint != tc.mountPoint {
+				t.Error(
+					"For", tc.path,
+					"expected", tc.propagation, tc.mountPoint,
+					"got", propagation, mountPoint,
+				)
+			}
+		})
+	}
+
+	if _, _, err := getMountPropagation(nil, "/"); err == nil {
+		t.Error("expected an error without any mounts")
+	}
+}
@@ -17,12 +17,16 @@ limitations under the License.
 package linux
 
 import (
+	"fmt"
 	"github.com/hpe-storage/dory/common/util"
 )
 
 const (
 	selinuxenabled = "selinuxenabled"
 	chcon          = "chcon"
+	defaultUser    = "system_u"
+	defaultRole    = "object_r"
+	defaultLevel   = "s0"
 )
 
 //SelinuxEnabled runs selinuxenabled if found and returns the result.  If its not found, false is returned.
@@ -39,13 +43,35 @@ func SelinuxEnabled() bool {
 
 //Chcon - chcon -t svirt_sandbox_file_t <mount point>
 func Chcon(context, path string) error {
+	return ChconWithLevel(context, "", path)
+}
+
+//ChconWithLevel - chcon -t <type> [-l <level>] <path>.  The level is left alone if it's empty.
+func ChconWithLevel(context, level, path string) error {
 	if SelinuxEnabled() {
-		util.LogDebug.Printf("Chcon about to change context of %s to %s", path, context)
-		args := []string{"-t", context, path}
-		_, _, err := util.ExecCommandOutput(chcon, args)
+		util.LogDebug.Printf("ChconWithLevel about to change context of %s to %s level %s", path, context, level)
+		_, _, err := util.ExecCommandOutput(chcon, getChconArgs(context, level, path))
 		if err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+func getChconArgs(context, level, path string) []string {
+	args := []string{"-t", context}
+	if level != "" {
+		args = append(args, "-l", level)
+	}
+	return append(args, path)
+}
+
+//GetContextMountOption returns the context= mount option that labels a whole filesystem with
+//the type and level provided.  The level defaults to s0.  The value is quoted since MCS
+//levels can contain commas.
+func GetContextMountOption(context, level string) string {
+	if level == "" {
+		level = defaultLevel
+	}
+	return fmt.Sprintf("context=\"%s:%s:%s:%s\"", defaultUser, defaultRole, context, level)
+}
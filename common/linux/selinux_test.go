@@ -0,0 +1,44 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package linux
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGetChconArgs(t *testing.T) {
+	args := strings.Join(getChconArgs("container_file_t", "", "/mnt/vol"), " ")
+	if args != "-t container_file_t /mnt/vol" {
+		t.Error("unexpected args without a level", args)
+	}
+	args = strings.Join(getChconArgs("container_file_t", "s0:c1,c2", "/mnt/vol"), " ")
+	if args != "-t container_file_t -l s0:c1,c2 /mnt/vol" {
+		t.Error("unexpected args with a level", args)
+	}
+}
+
+func TestGetContextMountOption(t *testing.T) {
+	option := GetContextMountOption("container_file_t", "")
+	if option != `context="system_u:object_r:container_file_t:s0"` {
+		t.Error("unexpected option without a level", option)
+	}
+	option = GetContextMountOption("svirt_sandbox_file_t", "s0:c1,c2")
+	if option != `context="system_u:object_r:svirt_sandbox_file_t:s0:c1,c2"` {
+		t.Error("unexpected option with a level", option)
+	}
+}
@@ -34,4 +34,5 @@ type Mount struct {
 	ID         uint64  `json:"id,omitempty"`
 	Mountpoint string  `json:"mount_point,omitempty"`
 	Device     *Device `json:"device,omitempty"`
+	FsType     string  `json:"fs_type,omitempty"`
 }
@@ -0,0 +1,56 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+const (
+	// SecretPrefix is the prefix of the option keys Kubernetes uses to deliver FlexVolume secrets
+	SecretPrefix = "kubernetes.io/secret/"
+	redacted     = "*****"
+)
+
+// secretRegex matches the json value of any key with the SecretPrefix
+var secretRegex = regexp.MustCompile(`("` + regexp.QuoteMeta(SecretPrefix) + `[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*"`)
+
+// RedactSecrets replaces the value of any secret found in the json contained in s
+func RedactSecrets(s string) string {
+	return secretRegex.ReplaceAllString(s, `${1}"`+redacted+`"`)
+}
+
+// RedactSecretOptions returns a copy of options with the value of any secret replaced
+func RedactSecretOptions(options map[string]interface{}) map[string]interface{} {
+	if options == nil {
+		return nil
+	}
+	safe := make(map[string]interface{}, len(options))
+	for key, value := range options {
+		if IsSecret(key) {
+			value = redacted
+		}
+		safe[key] = value
+	}
+	return safe
+}
+
+// IsSecret returns true if key is a secret delivered by Kubernetes
+func IsSecret(key string) bool {
+	return strings.HasPrefix(key, SecretPrefix)
+}
@@ -0,0 +1,58 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"testing"
+)
+
+var redactTests = []struct {
+	name     string
+	in       string
+	expected string
+}{
+	{"none", `{"size":"10","kubernetes.io/fsType":"xfs"}`, `{"size":"10","kubernetes.io/fsType":"xfs"}`},
+	{"one", `{"size":"10","kubernetes.io/secret/token":"c2VjcmV0"}`, `{"size":"10","kubernetes.io/secret/token":"*****"}`},
+	{"spaces", `{"kubernetes.io/secret/key" : "a\"b", "size": "1"}`, `{"kubernetes.io/secret/key" : "*****", "size": "1"}`},
+	{"args", `[/var/lib/kubelet/pods/x {"kubernetes.io/secret/a":"1","kubernetes.io/secret/b":"2"}]`, `[/var/lib/kubelet/pods/x {"kubernetes.io/secret/a":"*****","kubernetes.io/secret/b":"*****"}]`},
+}
+
+func TestRedactSecrets(t *testing.T) {
+	for _, tc := range redactTests {
+		t.Run(tc.name, func(t *testing.T) {
+			out := RedactSecrets(tc.in)
+			if out != tc.expected {
+				t.Error(
+					"For", tc.in,
+					"expected", tc.expected,
+					"got", out,
+				)
+			}
+		})
+	}
+}
+
+func TestRedactSecretOptions(t *testing.T) {
+	options := map[string]interface{}{"size": "10", "kubernetes.io/secret/token": "c2VjcmV0"}
+	safe := RedactSecretOptions(options)
+	if safe["kubernetes.io/secret/token"] != redacted || safe["size"] != "10" {
+		t.Error("For", options, "got", safe)
+	}
+	if options["kubernetes.io/secret/token"] != "c2VjcmV0" {
+		t.Error("options were modified", options)
+	}
+}
@@ -0,0 +1,152 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	//DefaultRetryMaxTries is the number of times an operation is tried
+	DefaultRetryMaxTries = 4
+	//DefaultRetryDelay is the delay before the first retry, it doubles for each retry after that
+	DefaultRetryDelay = time.Second
+	//DefaultRetryMaxDelay caps the delay between tries
+	DefaultRetryMaxDelay = 8 * time.Second
+	//DefaultRetryJitterPercent is how much each delay is randomly shortened or lengthened
+	DefaultRetryJitterPercent = 20
+	//DefaultRetryBudget is the overall time allowed for retries, it's well inside kubelet's call-out timeout
+	DefaultRetryBudget = 90 * time.Second
+)
+
+//DefaultRetryPolicy is used when no policy is provided.  Each operation it retries has its own
+//deadline, DefaultRetryBudget after the operation starts.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxTries:      DefaultRetryMaxTries,
+	Delay:         DefaultRetryDelay,
+	MaxDelay:      DefaultRetryMaxDelay,
+	JitterPercent: DefaultRetryJitterPercent,
+	Budget:        DefaultRetryBudget,
+}
+
+//RetryPolicy controls how an operation is retried.  The delay between tries backs off
+//exponentially with jitter.  Operations that share a policy share its deadline, so nested
+//retries stop once the deadline would be passed instead of multiplying.
+type RetryPolicy struct {
+	//MaxTries is the number of times an operation is tried, including the first try
+	MaxTries int
+	//Delay is the delay before the first retry
+	Delay time.Duration
+	//MaxDelay caps the delay between tries
+	MaxDelay time.Duration
+	//JitterPercent randomly shortens or lengthens each delay by up to this percent
+	JitterPercent int
+	//Deadline is when retries stop, zero means no deadline
+	Deadline time.Time
+	//Budget is used as the deadline of each operation, counted from when it starts, if Deadline is zero
+	Budget time.Duration
+}
+
+//NewRetryPolicy returns a policy whose deadline is budget from now.  A budget of zero means no deadline.
+func NewRetryPolicy(maxTries int, delay, maxDelay time.Duration, jitterPercent int, budget time.Duration) *RetryPolicy {
+	policy := &RetryPolicy{
+		MaxTries:      maxTries,
+		Delay:         delay,
+		MaxDelay:      maxDelay,
+		JitterPercent: jitterPercent,
+	}
+	if budget > 0 {
+		policy.Deadline = time.Now().Add(budget)
+	}
+	return policy
+}
+
+//noRetryError stops Do from retrying
+type noRetryError struct {
+	err error
+}
+
+func (e *noRetryError) Error() string {
+	return e.err.Error()
+}
+
+//NoRetry wraps err so that Do returns err without retrying.  It's used when op has already been
+//retried at a lower level, so that nested retries don't multiply.
+func NoRetry(err error) error {
+	return &noRetryError{err: err}
+}
+
+//GetDeadline returns the deadline of an operation that starts at start.  Zero means no deadline.
+func (p *RetryPolicy) GetDeadline(start time.Time) time.Time {
+	if p == nil {
+		p = DefaultRetryPolicy
+	}
+	if p.Deadline.IsZero() && p.Budget > 0 {
+		return start.Add(p.Budget)
+	}
+	return p.Deadline
+}
+
+//Do calls op until it succeeds, MaxTries is reached or the next delay would pass the deadline.
+//op is passed the try number starting at 1.  The last error is returned.  An error wrapped by
+//NoRetry is returned, unwrapped, without retrying.
+func (p *RetryPolicy) Do(description string, op func(try int) error) error {
+	if p == nil {
+		p = DefaultRetryPolicy
+	}
+	deadline := p.GetDeadline(time.Now())
+	for try := 1; ; try++ {
+		err := op(try)
+		if err == nil {
+			return nil
+		}
+		if e, ok := err.(*noRetryError); ok {
+			LogDebug.Printf("%s failed on try %d and won't be retried - %s", description, try, e.err.Error())
+			return e.err
+		}
+		if try >= p.MaxTries {
+			LogDebug.Printf("%s failed after %d tries - %s", description, try, err.Error())
+			return err
+		}
+		delay := p.getDelay(try)
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			LogInfo.Printf("%s failed on try %d and the retry deadline %s would be passed - %s", description, try, deadline.Format(time.RFC3339), err.Error())
+			return err
+		}
+		LogDebug.Printf("%s failed on try %d, retrying in %v - %s", description, try, delay, err.Error())
+		time.Sleep(delay)
+	}
+}
+
+// getDelay returns the delay after the given try
+func (p *RetryPolicy) getDelay(try int) time.Duration {
+	delay := p.Delay
+	for i := 1; i < try && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if p.JitterPercent > 0 && delay > 0 {
+		jitter := int64(delay) * int64(p.JitterPercent) / 100
+		if jitter > 0 {
+			delay += time.Duration(rand.Int63n(2*jitter+1) - jitter)
+		}
+	}
+	return delay
+}
@@ -0,0 +1,125 @@
+/*
+(c) Copyright 2018 Hewlett Packard Enterprise Development LP
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package util
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := &RetryPolicy{MaxTries: 10, Delay: time.Second, MaxDelay: 5 * time.Second}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if got := policy.getDelay(i + 1); got != delay {
+			t.Errorf("For try %d expected %v got %v", i+1, delay, got)
+		}
+	}
+
+	policy.JitterPercent = 20
+	for i := 0; i < 100; i++ {
+		if got := policy.getDelay(1); got < 800*time.Millisecond || got > 1200*time.Millisecond {
+			t.Fatal("expected the jittered delay to be within 20% of 1s got", got)
+		}
+	}
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	failure := errors.New("failed")
+	policy := &RetryPolicy{MaxTries: 3, Delay: time.Millisecond}
+	tries := 0
+	err := policy.Do("test", func(try int) error {
+		tries = try
+		return failure
+	})
+	if err != failure || tries != 3 {
+		t.Errorf("expected 3 tries and the last error got %d tries and %v", tries, err)
+	}
+
+	tries = 0
+	err = policy.Do("test", func(try int) error {
+		tries = try
+		if try < 2 {
+			return failure
+		}
+		return nil
+	})
+	if err != nil || tries != 2 {
+		t.Errorf("expected success on try 2 got %d tries and %v", tries, err)
+	}
+
+	// the deadline stops retries before MaxTries
+	policy = NewRetryPolicy(10, time.Hour, time.Hour, 0, time.Minute)
+	tries = 0
+	start := time.Now()
+	err = policy.Do("test", func(try int) error {
+		tries = try
+		return failure
+	})
+	if err != failure || tries != 1 || time.Since(start) > time.Second {
+		t.Errorf("expected the deadline to stop after 1 try got %d tries and %v", tries, err)
+	}
+
+	// a nil policy uses the default
+	var nilPolicy *RetryPolicy
+	err = nilPolicy.Do("test", func(try int) error { return nil })
+	if err != nil {
+		t.Error("expected a nil policy to work got", err)
+	}
+}
+
+func TestRetryPolicyGetDeadline(t *testing.T) {
+	start := time.Now()
+	var nilPolicy *RetryPolicy
+	if deadline := nilPolicy.GetDeadline(start); !deadline.Equal(start.Add(DefaultRetryBudget)) {
+		t.Error("expected the default policy to have a deadline of", start.Add(DefaultRetryBudget), "got", deadline)
+	}
+	deadline := start.Add(time.Minute)
+	policy := &RetryPolicy{Deadline: deadline, Budget: time.Hour}
+	if got := policy.GetDeadline(start); !got.Equal(deadline) {
+		t.Error("expected the policy's deadline", deadline, "got", got)
+	}
+	policy = &RetryPolicy{MaxTries: 3}
+	if got := policy.GetDeadline(start); !got.IsZero() {
+		t.Error("expected no deadline got", got)
+	}
+
+	// the budget stops retries before MaxTries
+	policy = &RetryPolicy{MaxTries: 10, Delay: time.Hour, Budget: time.Minute}
+	tries := 0
+	err := policy.Do("test", func(try int) error {
+		tries = try
+		return errors.New("failed")
+	})
+	if err == nil || tries != 1 {
+		t.Errorf("expected the budget to stop after 1 try got %d tries and %v", tries, err)
+	}
+}
+
+func TestRetryPolicyDoNoRetry(t *testing.T) {
+	failure := errors.New("failed")
+	policy := &RetryPolicy{MaxTries: 3, Delay: time.Millisecond}
+	tries := 0
+	err := policy.Do("test", func(try int) error {
+		tries = try
+		return NoRetry(failure)
+	})
+	if err != failure || tries != 1 {
+		t.Errorf("expected 1 try and the unwrapped error got %d tries and %v", tries, err)
+	}
+}